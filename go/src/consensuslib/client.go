@@ -1,13 +1,22 @@
 package consensuslib
 
 import (
+	"consensuslib/message"
 	"consensuslib/paxosnode"
-	"filelogger/singletonlogger"
+	"consensuslib/paxosnode/connmanager"
+	"consensuslib/paxosnode/faults"
+	"consensuslib/paxosnode/index"
+	"consensuslib/security"
+	"filelogger/logger"
+	"filelogger/vclock"
 	"fmt"
 	"math/rand"
 	"net"
 	"net/rpc"
+	"os"
 	"paxostracker"
+	"paxostracker/breakpoint"
+	"sync"
 	"time"
 )
 
@@ -17,6 +26,19 @@ const MSGHASHLEN = 4
 // PaxosNodeRPCWrapper is the rpc wrapper around the paxos node
 type PaxosNodeRPCWrapper = paxosnode.PaxosNodeRPCWrapper
 
+// PeerStatus is the connection state of one neighbour
+type PeerStatus = connmanager.PeerStatus
+
+// Hit is an entry found by a search, with a snippet of its value
+type Hit = index.Hit
+
+// Entry is the value learned at one slot of the log
+type Entry struct {
+	Slot     int
+	Value    string
+	Proposer string // address of the node whose proposal it was
+}
+
 // Client in the consensuslib
 type Client struct {
 	localAddr     string
@@ -25,16 +47,28 @@ type Client struct {
 
 	listener        net.Listener
 	serverRPCClient *rpc.Client
+	sec             *security.Config
 
 	paxosNode           *paxosnode.PaxosNode
 	paxosNodeRPCWrapper *PaxosNodeRPCWrapper
 	neighbors           []string
+
+	logger *logger.Logger
 }
 
-// NewClient creates a new Client, ready to connect
-func NewClient(localAddr string, outboundAddr string, heartbeatRate time.Duration) (client *Client, err error) {
+// NewClient creates a new Client, ready to connect.
+// A nil sec keeps plain TCP and no join token. Otherwise the server and every neighbour are reached over mutual TLS
+// if sec has TLS, and the join token in sec is proven to them when joining.
+// The client and its paxos node log to log, or nowhere when log is nil. Give each client in one
+// process its own logger, e.g. logger.NewFileLogger("client2001", state.QUIET), for their logs to be told apart.
+func NewClient(localAddr string, outboundAddr string, heartbeatRate time.Duration, sec *security.Config, log *logger.Logger) (client *Client, err error) {
+	if log == nil {
+		log = logger.NewDiscardLogger("client" + localAddr)
+	}
 	client = &Client{
 		heartbeatRate: heartbeatRate,
+		sec:           sec,
+		logger:        log,
 	}
 
 	addr, err := net.ResolveTCPAddr("tcp", localAddr)
@@ -42,17 +76,21 @@ func NewClient(localAddr string, outboundAddr string, heartbeatRate time.Duratio
 		return nil, fmt.Errorf("[LIB/CLIENT]#NewClient: unable to resolve client addr: %s", err)
 	}
 
-	client.listener, err = net.ListenTCP("tcp", addr)
+	client.listener, err = sec.Listen(addr.String())
 	if err != nil {
 		return nil, fmt.Errorf("[LIB/CLIENT]#NewClient: Unable to listen to IP address '%s': %s", addr, err)
 	}
 	client.localAddr = client.listener.Addr().String()
-	client.outboundAddr = outboundAddr
-	singletonlogger.Debug(fmt.Sprintf("[LIB/CLIENT]#NewClient: Listening on IP address %v", client.localAddr))
-	singletonlogger.Debug(fmt.Sprintf("[LIB/CLIENT]#NewClient: Outbound IP address is %v", client.outboundAddr))
+	client.outboundAddr, err = boundOutboundAddr(outboundAddr, client.listener.Addr())
+	if err != nil {
+		client.listener.Close()
+		return nil, fmt.Errorf("[LIB/CLIENT]#NewClient: unable to resolve outbound addr: %s", err)
+	}
+	log.Debugf("[LIB/CLIENT]#NewClient: Listening on IP address %v", client.localAddr)
+	log.Debugf("[LIB/CLIENT]#NewClient: Outbound IP address is %v", client.outboundAddr)
 
 	// create the paxosnode
-	client.paxosNode, err = paxosnode.NewPaxosNode(client.outboundAddr)
+	client.paxosNode, err = paxosnode.NewPaxosNode(client.outboundAddr, sec, log)
 	if err != nil {
 		return nil, fmt.Errorf("[LIB/CLIENT]#NewClient: Unable to create a paxos node: %s", err)
 	}
@@ -62,24 +100,43 @@ func NewClient(localAddr string, outboundAddr string, heartbeatRate time.Duratio
 	if err != nil {
 		return nil, fmt.Errorf("[LIB/CLIENT]#NewClient: Unable to create RPC wrapper: %s", err)
 	}
-	rpc.Register(client.paxosNodeRPCWrapper)
-	go rpc.Accept(client.listener)
-
-	paxostracker.NewPaxosTracker()
+	go paxosnode.Serve(client.listener, client.paxosNodeRPCWrapper)
 	return client, nil
 }
 
+// boundOutboundAddr fills in the port the listener was given when outboundAddr asks for any port (0),
+// so that peers dial the port actually being listened on
+func boundOutboundAddr(outboundAddr string, listenAddr net.Addr) (string, error) {
+	host, port, err := net.SplitHostPort(outboundAddr)
+	if err != nil {
+		return "", err
+	}
+	if port != "0" {
+		return outboundAddr, nil
+	}
+	_, listenPort, err := net.SplitHostPort(listenAddr.String())
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, listenPort), nil
+}
+
 // Connect the client to the server at serverAddr
 func (c *Client) Connect(serverAddr string) (err error) {
-	c.serverRPCClient, err = rpc.Dial("tcp", serverAddr)
+	c.serverRPCClient, err = c.sec.DialRPC(serverAddr, c.paxosNode.VClock)
 	if err != nil {
 		return fmt.Errorf("[LIB/CLIENT]#Connect: Unable to connect to server: %s", err)
 	}
 
 	// Register outboundAddr with the server so the server can 1) receive heartbeats, and 2) inform neighbours about us
 	// The server will populate our neighbours field with our neighbours
-	singletonlogger.Debug(fmt.Sprintf("[LIB/CLIENT]#Connect: Registering to server at: %s\n", serverAddr))
-	err = c.serverRPCClient.Call("Server.Register", c.outboundAddr, &c.neighbors)
+	c.logger.Debugf("[LIB/CLIENT]#Connect: Registering to server at: %s\n", serverAddr)
+	var challenge string
+	err = c.serverRPCClient.Call("Server.Challenge", c.outboundAddr, &challenge)
+	if err != nil {
+		return fmt.Errorf("[LIB/CLIENT]#Connect: Unable to get a join challenge from server: %s", err)
+	}
+	err = c.serverRPCClient.Call("Server.Register", c.sec.NewJoinRequest(c.outboundAddr, challenge), &c.neighbors)
 	if err != nil {
 		return fmt.Errorf("[LIB/CLIENT]#Connect: Unable to register with server: %s", err)
 	}
@@ -89,12 +146,12 @@ func (c *Client) Connect(serverAddr string) (err error) {
 	// Then, choose the longest log received from the neighbours. Lastly, set up the round number the network is
 	// currently at.
 	if len(c.neighbors) > 0 {
-		singletonlogger.Debug(fmt.Sprintf("[LIB/CLIENT]#Connect: Neighbors: %v\n", c.neighbors))
+		c.logger.Debugf("[LIB/CLIENT]#Connect: Neighbors: %v\n", c.neighbors)
 		err = c.paxosNode.BecomeNeighbours(c.neighbors)
 		if err != nil {
 			return fmt.Errorf("[LIB/CLIENT]#Connect: Unable to connect to neighbors: %s", err)
 		}
-		singletonlogger.Debug("[LIB/CLIENT]#Connect: Learning the latest value from neighbours")
+		c.logger.Debug("[LIB/CLIENT]#Connect: Learning the latest value from neighbours")
 		err = c.paxosNode.LearnLatestValueFromNeighbours()
 		log := c.paxosNode.Learner.Log
 		if len(log) != 0 {
@@ -116,21 +173,98 @@ func (c *Client) Read() (value string, err error) {
 	if err != nil {
 		return "", fmt.Errorf("[LIB/CLIENT]#Read: Error while getting the log: %s", err)
 	}
-	singletonlogger.Debug(fmt.Sprintf("[LIB/CLIENT]#Read: Log = '%v'\n", log))
+	c.logger.Debugf("[LIB/CLIENT]#Read: Log = '%v'\n", log)
 	for _, m := range log {
 		value += m.Value + "\n"
 	}
 	return value, nil
 }
 
+// Entries of the node's version of the log, in slot order
+func (c *Client) Entries() (entries []Entry, err error) {
+	log, err := c.paxosNode.GetLog()
+	if err != nil {
+		return nil, fmt.Errorf("[LIB/CLIENT]#Entries: Error while getting the log: %s", err)
+	}
+	return entriesFrom(0, log), nil
+}
+
+// ReadRange of the node's version of the log, the entries in slots from up to, but not including, to.
+// The range stops at the end of the log, so the entries past it are read as none.
+func (c *Client) ReadRange(from int, to int) (entries []Entry, err error) {
+	log, err := c.paxosNode.GetLogRange(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("[LIB/CLIENT]#ReadRange: %s", err)
+	}
+	return entriesFrom(from, log), nil
+}
+
+// ReadRangeFrom the version of the log of the neighbour at peer, the entries in slots from up to, but not
+// including, to
+func (c *Client) ReadRangeFrom(peer string, from int, to int) (entries []Entry, err error) {
+	log, err := c.paxosNode.ReadRangeFromNeighbour(peer, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("[LIB/CLIENT]#ReadRangeFrom: %s", err)
+	}
+	return entriesFrom(from, log), nil
+}
+
+// Len of the node's version of the log
+func (c *Client) Len() int {
+	return c.paxosNode.GetLogLength()
+}
+
+// entriesFrom the values of log, the first of which is at slot from
+func entriesFrom(from int, log []message.Message) []Entry {
+	entries := make([]Entry, len(log))
+	for i, m := range log {
+		entries[i] = Entry{Slot: from + i, Value: m.Value, Proposer: m.FromProposerID}
+	}
+	return entries
+}
+
+// Subscribe to the entries of the node's version of the log from slot fromIndex on, in slot order, the entries
+// already learned first and then each one as it is learned, from slot 0 if fromIndex is negative.
+// The channel is closed once cancel is called.
+// Entries wait for the subscriber to take them, without holding up the node.
+func (c *Client) Subscribe(fromIndex int) (entries <-chan Entry, cancel func()) {
+	ch := make(chan Entry)
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer close(ch)
+		c.paxosNode.Learner.Follow(fromIndex, done, func(slot int, m message.Message) {
+			select {
+			case ch <- Entry{Slot: slot, Value: m.Value, Proposer: m.FromProposerID}:
+			case <-done:
+			}
+		})
+	}()
+	return ch, func() { once.Do(func() { close(done) }) }
+}
+
+// Search the node's version of the log for the entries with every term of query, oldest first.
+// Terms are the words of the query, matched regardless of case and punctuation.
+func (c *Client) Search(query string) (hits []Hit, err error) {
+	if len(index.Terms(query)) == 0 {
+		return nil, fmt.Errorf("[LIB/CLIENT]#Search: no terms to search for in '%s'", query)
+	}
+	return c.paxosNode.Learner.Index.Search(query), nil
+}
+
 // Write to the shared log
 func (c *Client) Write(value string) (err error) {
-	paxostracker.Prepare(c.listener.Addr().String())
+	c.paxosNode.Tracker.Prepare(breakpoint.Context{Round: c.paxosNode.RoundNum, Value: value, Peer: c.outboundAddr})
 	messageHash := generateMessageHash(MSGHASHLEN)
 	_, err = c.paxosNode.WriteToPaxosNode(value, messageHash, paxosnode.TTL)
 	return err
 }
 
+// Addr the client's paxos node is reached at by its neighbours
+func (c *Client) Addr() string {
+	return c.outboundAddr
+}
+
 // IsAlive checks if the server is alive
 func (c *Client) IsAlive() (alive bool, err error) {
 	// alive is default false
@@ -138,6 +272,68 @@ func (c *Client) IsAlive() (alive bool, err error) {
 	return alive, err
 }
 
+// ListNodes asks the server for every registered node and when it was last heard from
+func (c *Client) ListNodes() (nodes []NodeStatus, err error) {
+	err = c.serverRPCClient.Call("Server.ListNodes", c.outboundAddr, &nodes)
+	if err != nil {
+		return nil, fmt.Errorf("[LIB/CLIENT]#ListNodes: Unable to list nodes: %s", err)
+	}
+	return nodes, nil
+}
+
+// Neighbours reports the connection state of each of the node's neighbours
+func (c *Client) Neighbours() []PeerStatus {
+	return c.paxosNode.NeighbourStatus()
+}
+
+// Tracker returns the tracker following this client's paxos rounds, for its breakpoints, rounds and state
+func (c *Client) Tracker() *paxostracker.PaxosTracker {
+	return c.paxosNode.Tracker
+}
+
+// RecordTrace records every protocol message of this client's paxos node to a new trace file at path.
+// It must be called before Connect, for the trace to be replayable from the start.
+func (c *Client) RecordTrace(path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("[LIB/CLIENT]#RecordTrace: Unable to create trace file: %s", err)
+	}
+	c.paxosNode.StartTrace(f)
+	return nil
+}
+
+// LogVectorClocks logs the events of this client's paxos node with vector clocks, carried on every RPC it makes or
+// serves, to a ShiViz log in logs/. Pings and heartbeats are left out of it.
+// It must be called before Connect, for every message to be logged.
+func (c *Client) LogVectorClocks() (err error) {
+	vlog, err := vclock.NewLogger("client", c.outboundAddr)
+	if err != nil {
+		return fmt.Errorf("[LIB/CLIENT]#LogVectorClocks: %s", err)
+	}
+	vlog.Ignore("PaxosNodeRPCWrapper.Ping", "Server.HeartBeat")
+	c.paxosNode.VClock = vlog
+	return nil
+}
+
+// EnableDebugControl lets debug clients, like ddctl, arm breakpoints, kill, step and inject faults on this client's
+// paxos node over its port. Anyone who can reach the port can then do so, unless the cluster has a join token.
+// It must be called before Connect.
+func (c *Client) EnableDebugControl() {
+	c.paxosNode.DebugControl = true
+}
+
+// Faults returns the fault rules applied to this client's calls to its neighbours
+func (c *Client) Faults() *faults.Injector {
+	return c.paxosNode.Faults
+}
+
+// ClusterRounds merges the rounds recorded by this node and all of its neighbours into one timeline.
+// Neighbours that could not be asked are returned as unreachable.
+func (c *Client) ClusterRounds() (timeline []paxostracker.Slot, unreachable []string) {
+	reports, unreachable := c.paxosNode.ClusterRounds()
+	return paxostracker.Timeline(reports), unreachable
+}
+
 // SendHeartbeats to the server
 func (c *Client) SendHeartbeats() (err error) {
 	for _ = range time.Tick(c.heartbeatRate) {
@@ -0,0 +1,109 @@
+package consensuslib
+
+import (
+	"consensuslib/paxosnode/faults"
+	"consensuslib/security"
+	"fmt"
+	"net/rpc"
+	"paxostracker/breakpoint"
+)
+
+// DEBUGCLIENTADDR is the name a debug client answers join challenges for, as it is not a node with an address
+const DEBUGCLIENTADDR = "ddctl"
+
+// DebugClient drives the paxostracker of a node from outside it, over the node's debug-control RPC service
+type DebugClient struct {
+	nodeAddr  string
+	rpcClient *rpc.Client
+}
+
+// DialDebug connects to the debug-control service of the node at nodeAddr, which the node must have enabled.
+// sec must match the cluster's: the same CA for mutual TLS, and the join token if one is required.
+func DialDebug(nodeAddr string, sec *security.Config) (d *DebugClient, err error) {
+	d = &DebugClient{nodeAddr: nodeAddr}
+	d.rpcClient, err = sec.DialRPC(nodeAddr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("[LIB/DEBUG]#DialDebug: Unable to connect to node %s: %s", nodeAddr, err)
+	}
+	if !sec.JoinRequired() {
+		return d, nil
+	}
+	var challenge string
+	err = d.rpcClient.Call("DebugControl.Challenge", DEBUGCLIENTADDR, &challenge)
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("[LIB/DEBUG]#DialDebug: Unable to get a challenge from node %s: %s", nodeAddr, err)
+	}
+	var ok bool
+	err = d.rpcClient.Call("DebugControl.Authenticate", sec.NewJoinRequest(DEBUGCLIENTADDR, challenge), &ok)
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("[LIB/DEBUG]#DialDebug: Node %s refused the join token: %s", nodeAddr, err)
+	}
+	return d, nil
+}
+
+// Break arms b on the node, returning the breakpoint's ID there
+func (d *DebugClient) Break(b breakpoint.Breakpoint) (id int, err error) {
+	err = d.rpcClient.Call("DebugControl.Break", b, &id)
+	return id, err
+}
+
+// Breakpoints lists the breakpoints armed on the node
+func (d *DebugClient) Breakpoints() (breakpoints []breakpoint.Breakpoint, err error) {
+	err = d.rpcClient.Call("DebugControl.Breakpoints", "placeholder", &breakpoints)
+	return breakpoints, err
+}
+
+// Delete disarms the breakpoint with the given ID on the node
+func (d *DebugClient) Delete(id int) (err error) {
+	var ok bool
+	return d.rpcClient.Call("DebugControl.Delete", id, &ok)
+}
+
+// Paused reports where the node is paused
+func (d *DebugClient) Paused() (paused []breakpoint.Context, err error) {
+	err = d.rpcClient.Call("DebugControl.Paused", "placeholder", &paused)
+	return paused, err
+}
+
+// Continue every paused stage of the node
+func (d *DebugClient) Continue() (err error) {
+	var ok bool
+	return d.rpcClient.Call("DebugControl.Continue", "placeholder", &ok)
+}
+
+// Step every paused stage of the node to the next one, returning the stages it will break at
+func (d *DebugClient) Step() (next []breakpoint.Stage, err error) {
+	err = d.rpcClient.Call("DebugControl.Step", "placeholder", &next)
+	return next, err
+}
+
+// SetFault sets the fault rule for r.Peer on the node
+func (d *DebugClient) SetFault(r faults.Rule) (err error) {
+	var ok bool
+	return d.rpcClient.Call("DebugControl.SetFault", r, &ok)
+}
+
+// Faults lists the fault rules set on the node
+func (d *DebugClient) Faults() (rules []faults.Rule, err error) {
+	err = d.rpcClient.Call("DebugControl.Faults", "placeholder", &rules)
+	return rules, err
+}
+
+// Partition the node from every peer in peers
+func (d *DebugClient) Partition(peers []string) (err error) {
+	var ok bool
+	return d.rpcClient.Call("DebugControl.Partition", peers, &ok)
+}
+
+// Heal removes the node's fault rules for peers, or all of them when no peers are given
+func (d *DebugClient) Heal(peers []string) (err error) {
+	var ok bool
+	return d.rpcClient.Call("DebugControl.Heal", peers, &ok)
+}
+
+// Close the connection to the node
+func (d *DebugClient) Close() error {
+	return d.rpcClient.Close()
+}
@@ -35,6 +35,12 @@ func (e InvalidLogIndexError) Error() string {
 	return fmt.Sprintf("Unable to access the given index in the log.")
 }
 
+type InvalidLogRangeError string
+
+func (e InvalidLogRangeError) Error() string {
+	return fmt.Sprintf("Unable to read the given range of the log: %s", string(e))
+}
+
 type ValueForRoundInLogExistsError string
 
 func (e ValueForRoundInLogExistsError) Error() string {
@@ -46,3 +52,15 @@ type TimeoutError string
 func (e TimeoutError) Error() string {
 	return fmt.Sprintf("The function [%s] called timed out.", string(e))
 }
+
+type PeerIdentityError string
+
+func (e PeerIdentityError) Error() string {
+	return fmt.Sprintf("Peer is not allowed to claim this address: %s", string(e))
+}
+
+type JoinRefusedError string
+
+func (e JoinRefusedError) Error() string {
+	return fmt.Sprintf("Refused to admit node to the cluster: %s", string(e))
+}
@@ -21,6 +21,8 @@ type Message struct {
 	FromProposerID string  // Proposer's ID to distinguish when same ID message arrived
 	RoundNum       int     // The number of the round the message is for
 	Bounces        int     // TTL for the message
+	Sender         string  // node that sent an accepted notice, set by the acceptor when it notifies learners
+	Clock          int     // Lamport clock of the node that sent the message when tracing, 0 otherwise
 }
 
 // generates a new message
@@ -33,6 +35,8 @@ func NewMessage(id uint64, msgHash string, msgType MsgType, val string, pid stri
 		pid,
 		roundNum,
 		ttl,
+		"",
+		0,
 	}
 	return m
 }
@@ -0,0 +1,75 @@
+package consensuslib
+
+import (
+	"fmt"
+	"metrics"
+)
+
+// serverMetrics of the server's view of the cluster
+type serverMetrics struct {
+	registry        *metrics.Registry
+	registrations   *metrics.Counter
+	heartbeatMisses *metrics.Counter
+	evictions       *metrics.Counter
+}
+
+// newServerMetrics registers the metrics of s
+func newServerMetrics(s *Server) *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry:        r,
+		registrations:   r.Counter("paxos_server_registrations_total", "Nodes registered with the server.", nil),
+		heartbeatMisses: r.Counter("paxos_server_heartbeat_misses_total", "Times a node went without a heartbeat long enough to be suspected.", nil),
+		evictions:       r.Counter("paxos_server_evictions_total", "Nodes dropped from the membership for missing their heartbeats.", nil),
+	}
+	for _, state := range []NodeState{Alive, Suspected} {
+		state := state
+		r.GaugeFunc("paxos_server_nodes", "Nodes registered, by the server's belief about their liveness.", metrics.Labels{"state": string(state)}, func() float64 {
+			return float64(s.countNodes(state))
+		})
+	}
+	return m
+}
+
+// countNodes registered in state
+func (s *Server) countNodes(state NodeState) (n int) {
+	s.users.RLock()
+	defer s.users.RUnlock()
+	for _, user := range s.users.all {
+		if user.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+// Metrics of the server
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics.registry
+}
+
+// ServeMetrics serves the server's metrics over HTTP at /metrics on addr, in the background, returning the address
+func (s *Server) ServeMetrics(addr string) (bound string, err error) {
+	listener, err := metrics.Serve(addr, s.metrics.registry)
+	if err != nil {
+		return "", fmt.Errorf("[ConsensusLib/serv] %s", err)
+	}
+	s.logger.Infof("Serving metrics at http://%s%s", listener.Addr(), metrics.PATH)
+	return listener.Addr().String(), nil
+}
+
+// Metrics of the client's paxos node
+func (c *Client) Metrics() *metrics.Registry {
+	return c.paxosNode.Metrics.Registry
+}
+
+// ServeMetrics serves the metrics of the client's paxos node over HTTP at /metrics on addr, in the background,
+// returning the address
+func (c *Client) ServeMetrics(addr string) (bound string, err error) {
+	listener, err := metrics.Serve(addr, c.paxosNode.Metrics.Registry)
+	if err != nil {
+		return "", fmt.Errorf("[LIB/CLIENT]#ServeMetrics: %s", err)
+	}
+	c.logger.Infof("[LIB/CLIENT] serving metrics at http://%s%s", listener.Addr(), metrics.PATH)
+	return listener.Addr().String(), nil
+}
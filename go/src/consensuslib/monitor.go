@@ -0,0 +1,127 @@
+package consensuslib
+
+import (
+	"container/heap"
+	"time"
+)
+
+/**
+ * The server watches heartbeats with a single sweeper goroutine.
+ * Every registered user sits in a min-heap ordered by the next moment its silence needs judging.
+ * Heartbeats only bump the user's timestamp; the sweeper re-schedules users as it pops them,
+ * so the users lock is only taken when a deadline has actually passed.
+ */
+
+// deadlineHeap is a container/heap of users ordered by their next deadline
+type deadlineHeap []*User
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].deadline < h[j].deadline }
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	user := x.(*User)
+	user.index = len(*h)
+	*h = append(*h, user)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	user := old[n-1]
+	old[n-1] = nil
+	user.index = -1
+	*h = old[:n-1]
+	return user
+}
+
+// schedule queues the user to be judged once it could next change state. Requires the users lock.
+func (s *Server) schedule(user *User) {
+	user.deadline = s.deadline(user)
+	heap.Push(&s.deadlines, user)
+	s.wakeSweeper()
+}
+
+// reschedule every queued user by the current config, e.g. once it has changed. Requires the users lock.
+func (s *Server) reschedule() {
+	queued := append([]*User(nil), s.deadlines...)
+	for _, user := range queued {
+		user.deadline = s.deadline(user)
+		heap.Fix(&s.deadlines, user.index)
+	}
+	s.wakeSweeper()
+}
+
+// deadline is when the user could next change state, judging by its last heartbeat
+func (s *Server) deadline(user *User) int64 {
+	switch user.State {
+	case Suspected:
+		return user.Heartbeat + int64(s.config.DeadAfter)
+	default:
+		return user.Heartbeat + int64(s.config.SuspectAfter)
+	}
+}
+
+// wakeSweeper makes the sweeper recompute how long it may sleep
+func (s *Server) wakeSweeper() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sweep judges every user whose deadline has passed, then sleeps until the next deadline
+func (s *Server) sweep() {
+	for {
+		s.users.Lock()
+		now := time.Now().UnixNano()
+		for len(s.deadlines) > 0 && s.deadlines[0].deadline <= now {
+			user := heap.Pop(&s.deadlines).(*User)
+			s.judge(user, now)
+		}
+		wait := time.Duration(-1)
+		if len(s.deadlines) > 0 {
+			wait = time.Duration(s.deadlines[0].deadline - now)
+		}
+		s.users.Unlock()
+
+		if wait < 0 {
+			// nobody registered, sleep until someone is
+			<-s.wake
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// judge moves a user along alive -> suspected -> dead based on its silence. Requires the users lock.
+func (s *Server) judge(user *User, now int64) {
+	silence := time.Duration(now - user.Heartbeat)
+	switch {
+	case silence >= s.config.DeadAfter:
+		user.State = Dead
+		delete(s.users.all, user.Address)
+		s.metrics.evictions.Inc()
+		s.logger.Infof("%s timed out", user.Address)
+		return
+	case silence >= s.config.SuspectAfter:
+		if user.State != Suspected {
+			s.metrics.heartbeatMisses.Inc()
+			s.logger.Warnf("%s is suspected, no heartbeat for %v", user.Address, silence)
+		}
+		user.State = Suspected
+	default:
+		user.State = Alive
+	}
+	s.schedule(user)
+}
@@ -2,9 +2,9 @@ package acceptor
 
 import (
 	"consensuslib/message"
+	"consensuslib/paxosnode/backup"
 	"encoding/json"
-	"filelogger/singletonlogger"
-	"fmt"
+	"filelogger/logger"
 	"io/ioutil"
 	"os"
 )
@@ -15,15 +15,26 @@ type AcceptorRole struct {
 	ID           string
 	LastPromised Message
 	LastAccepted Message
+	logger       *logger.Logger
+	history      *backup.Journal // of the decisions made
 }
 
-func NewAcceptor(id string) AcceptorRole {
+// Decision is one line of an acceptor's history, for offline safety checks
+type Decision struct {
+	Request  Message // prepare or accept request answered
+	Round    int     // round the acceptor was in
+	Promised bool    // the request was a prepare, and was promised
+	Accepted bool    // the request was an accept, and was accepted
+}
+
+// NewAcceptor creates the acceptor of the PN with the given ID, logging to log
+func NewAcceptor(id string, log *logger.Logger) AcceptorRole {
 	acc := AcceptorRole{
-		id,
-		Message{},
-		Message{},
+		ID:      id,
+		logger:  log,
+		history: backup.NewJournal(backup.Path(id, backup.HISTORY)),
 	}
-	singletonlogger.Debug(fmt.Sprintf("[Acceptor] %v", acc.ID))
+	log.Debugf("[Acceptor] %v", acc.ID)
 	return acc
 }
 
@@ -47,7 +58,7 @@ type AcceptorInterface interface {
 }
 
 func (acceptor *AcceptorRole) ProcessPrepare(msg Message, roundNum int) Message {
-	singletonlogger.Debug(fmt.Sprintf("[Acceptor] process prepare for round %v", roundNum))
+	acceptor.logger.Debugf("[Acceptor] process prepare for round %v", roundNum)
 	// no any value had been proposed or n'>n
 	// then n' == n and ID' == ID (basically same proposer distributed proposal twice)
 	if &acceptor.LastPromised == nil ||
@@ -58,13 +69,14 @@ func (acceptor *AcceptorRole) ProcessPrepare(msg Message, roundNum int) Message
 		acceptor.LastPromised.RoundNum == roundNum {
 		acceptor.LastPromised = msg
 	}
-	singletonlogger.Debug(fmt.Sprintf("[Acceptor] promised id: %d, val: %s, round: %d \n", acceptor.LastPromised.ID, acceptor.LastPromised.Value, roundNum))
+	acceptor.logger.Debugf("[Acceptor] promised id: %d, val: %s, round: %d \n", acceptor.LastPromised.ID, acceptor.LastPromised.Value, roundNum)
 	acceptor.saveIntoFile(acceptor.LastPromised)
+	acceptor.saveDecision(Decision{Request: msg, Round: roundNum, Promised: sameBallot(&acceptor.LastPromised, &msg)})
 	return acceptor.LastPromised
 }
 
 func (acceptor *AcceptorRole) ProcessAccept(msg Message, roundNum int) Message {
-	singletonlogger.Debug("[Acceptor] process accept")
+	acceptor.logger.Debug("[Acceptor] process accept")
 	if &acceptor.LastAccepted == nil {
 		if msg.ID == acceptor.LastPromised.ID &&
 			//msg.FromProposerID == acceptor.LastPromised.FromProposerID {
@@ -85,88 +97,106 @@ func (acceptor *AcceptorRole) ProcessAccept(msg Message, roundNum int) Message {
 			acceptor.LastAccepted = msg
 		}
 	}
-	singletonlogger.Debug(fmt.Sprintf("[Acceptor] accepted id: %d, val: %s, round: %d \n", acceptor.LastAccepted.ID, acceptor.LastAccepted.Value, roundNum))
+	acceptor.logger.Debugf("[Acceptor] accepted id: %d, val: %s, round: %d \n", acceptor.LastAccepted.ID, acceptor.LastAccepted.Value, roundNum)
 	//TODO: 2!!!! put in goroutine?
 	go acceptor.saveIntoFile(acceptor.LastAccepted)
+	acceptor.saveDecision(Decision{Request: msg, Round: roundNum, Accepted: sameBallot(&acceptor.LastAccepted, &msg)})
 	return acceptor.LastAccepted
 
 }
 
 func (acceptor *AcceptorRole) RestoreFromBackup() {
-	singletonlogger.Debug("[Acceptor] restoring from backup")
+	acceptor.logger.Debug("[Acceptor] restoring from backup")
 	path := "temp1/" + acceptor.ID + "prepare.json"
 	f, err := os.Open(path)
 	if err != nil {
-		singletonlogger.Debug(fmt.Sprintf("[Acceptor] no such file exist, no messages were promised %v", err))
+		acceptor.logger.Debugf("[Acceptor] no such file exist, no messages were promised %v", err)
 		return
 	}
 	buf, err := ioutil.ReadAll(f)
 	err = json.Unmarshal(buf, &acceptor.LastPromised)
 	if err != nil {
-		singletonlogger.Debug(fmt.Sprintf("[Acceptor] error on unmarshalling promise %v", err))
+		acceptor.logger.Debugf("[Acceptor] error on unmarshalling promise %v", err)
 	}
 	f.Close()
 	path = "temp1/" + acceptor.ID + "accept.json"
 	f, err = os.Open(path)
 	if err != nil {
-		singletonlogger.Debug(fmt.Sprintf("[Acceptor] no such file exist, no messages were accepted %v", err))
+		acceptor.logger.Debugf("[Acceptor] no such file exist, no messages were accepted %v", err)
 		return
 	}
 	buf, err = ioutil.ReadAll(f)
 	err = json.Unmarshal(buf, &acceptor.LastAccepted)
 	if err != nil {
-		singletonlogger.Debug(fmt.Sprintf("[Acceptor] error on unmarshalling accept %v", err))
+		acceptor.logger.Debugf("[Acceptor] error on unmarshalling accept %v", err)
 	}
 }
 
 // creates a log for acceptor in case of disconnection
 func (a *AcceptorRole) saveIntoFile(msg Message) (err error) {
 
-	singletonlogger.Debug("[Acceptor] saving message into file")
+	a.logger.Debug("[Acceptor] saving message into file")
 	var path string
 	msgJson, err := json.Marshal(msg)
 	if err != nil {
-		singletonlogger.Debug("[Acceptor] errored on marshalling")
+		a.logger.Debug("[Acceptor] errored on marshalling")
 		return err
 	}
 	var f *os.File
 	switch msg.Type {
 	case message.PREPARE:
 		path = "temp1/" + a.ID + "prepare.json"
-		singletonlogger.Debug("[Acceptor] saved PREPARE to file")
+		a.logger.Debug("[Acceptor] saved PREPARE to file")
 	case message.ACCEPT:
 		path = "temp1/" + a.ID + "accept.json"
-		singletonlogger.Debug("[Acceptor] saved ACCEPT to file")
+		a.logger.Debug("[Acceptor] saved ACCEPT to file")
 	}
 	if err != nil {
-		singletonlogger.Debug(fmt.Sprintf("[Acceptor] errored on reading path %v", err))
+		a.logger.Debugf("[Acceptor] errored on reading path %v", err)
 	}
 	if _, erro := os.Stat(path); os.IsNotExist(erro) {
 		os.MkdirAll("temp1/", os.ModePerm)
 		f, err = os.Create(path)
 		if err != nil {
-			singletonlogger.Debug(fmt.Sprintf("[Acceptor] errored on creating file %v", err))
+			a.logger.Debugf("[Acceptor] errored on creating file %v", err)
 		}
 
 	} else {
 		f, err = os.OpenFile(path, os.O_RDWR, 0644)
 		if err != nil {
-			singletonlogger.Debug(fmt.Sprintf("[Acceptor] errored on opening file %v", err))
+			a.logger.Debugf("[Acceptor] errored on opening file %v", err)
 		}
 		err = os.Truncate(path, 0)
 		if err != nil {
-			singletonlogger.Debug(fmt.Sprintf("[Acceptor] errored on truncating file %v", err))
+			a.logger.Debugf("[Acceptor] errored on truncating file %v", err)
 		}
 	}
 	//defer f.Close()
 	_, err = f.Write(msgJson)
 	if err != nil {
-		singletonlogger.Debug(fmt.Sprintf("[Acceptor] errored on writing into file %v", err))
+		a.logger.Debugf("[Acceptor] errored on writing into file %v", err)
 	}
 	f.Close()
 	return err
 }
 
+// sameBallot checks if m is m1, and not just a retry of the same value
+func sameBallot(m *Message, m1 *Message) bool {
+	return m.ID == m1.ID && m.Equals(m1)
+}
+
+// appends d to the acceptor's history, in the order the decisions were made
+func (a *AcceptorRole) saveDecision(d Decision) {
+	if err := a.history.Append(d); err != nil {
+		a.logger.Debugf("[Acceptor] errored on saving decision %v", err)
+	}
+}
+
+// Close the acceptor's history, e.g. when its PN is unmounted
+func (a *AcceptorRole) Close() error {
+	return a.history.Close()
+}
+
 /*
  * Methods for demo
  */
@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/**
+ * The files the roles of a PN keep on disk, all under DIR and prefixed with the ID of the PN (its port):
+ *   <ID>prepare.json, <ID>accept.json   the acceptor's last promise and accept, restored on restart
+ *   <ID>history.log                     every promise and accept decision of the acceptor, one per line
+ *   <ID>learned.log                     the learner's log, one value per line in slot order
+ *   <ID>proposals.log                   every value the proposer asked acceptors to accept, one per line
+ * Only the acceptor restores from them, the rest is kept for offline checks like ddcheck's.
+ */
+
+// DIR is where the PNs started from one working directory keep their files
+const DIR = "temp1/"
+
+// HISTORY is the file of an acceptor's decisions
+const HISTORY = "history.log"
+
+// LEARNED is the file of a learner's log
+const LEARNED = "learned.log"
+
+// PROPOSALS is the file of a proposer's accept requests
+const PROPOSALS = "proposals.log"
+
+// Path of the file name of the PN with the given ID
+func Path(id string, name string) string {
+	return DIR + id + name
+}
+
+// Journal appends lines of JSON to a file, which it keeps open between appends
+type Journal struct {
+	sync.Mutex
+	path string
+	f    *os.File // nil until the first append, and once closed
+}
+
+// NewJournal appends to the file at path, which is created on the first append
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Append v to the file as one line of JSON, in a single write so a crash never leaves half a line behind
+func (j *Journal) Append(v interface{}) (err error) {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	j.Lock()
+	defer j.Unlock()
+	if j.f == nil {
+		if err = os.MkdirAll(filepath.Dir(j.path), os.ModePerm); err != nil {
+			return err
+		}
+		j.f, err = os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = j.f.Write(append(line, '\n'))
+	return err
+}
+
+// Replace the file with one line of JSON per value of vs.
+// They are written aside and renamed over the file, so a crash never leaves it half replaced.
+func (j *Journal) Replace(vs []interface{}) (err error) {
+	var buf bytes.Buffer
+	for _, v := range vs {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	j.Lock()
+	defer j.Unlock()
+	if err = os.MkdirAll(filepath.Dir(j.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err = os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if j.f != nil {
+		// the next append opens the new file
+		j.f.Close()
+		j.f = nil
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// Close the file. Appending again reopens it.
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// ReadJSONLines calls decode on every line of the file at path
+func ReadJSONLines(path string, decode func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if err = decode(scanner.Bytes()); err != nil {
+			return fmt.Errorf("%s line %d: %s", path, n, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,266 @@
+package connmanager
+
+import (
+	"filelogger/logger"
+	"math/rand"
+	"net/rpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * Manager owns the RPC connections from a PaxosNode to its neighbours.
+ * A neighbour whose connection breaks is not forgotten: it is marked as connecting and redialed
+ * with exponential backoff until it answers again, so a brief network glitch does not split
+ * the Paxos network for good. A neighbour that does not answer MAXATTEMPTS redials in a row is
+ * given up on and forgotten, it rejoins by connecting to us again. Only connected neighbours are
+ * handed out for calls.
+ */
+
+// MINBACKOFF is the wait before the first redial of a lost neighbour
+const MINBACKOFF = 250 * time.Millisecond
+
+// MAXBACKOFF caps the wait between redials
+const MAXBACKOFF = 10 * time.Second
+
+// MAXATTEMPTS of failed redials before a lost neighbour is given up on, about a minute with the backoff
+const MAXATTEMPTS = 10
+
+// ConnState is the state of the connection to a single neighbour
+type ConnState string
+
+const (
+	// Connected neighbours take part in Paxos rounds
+	Connected ConnState = "connected"
+	// Connecting neighbours were lost and are being redialed
+	Connecting ConnState = "connecting"
+)
+
+// DialFunc opens a new RPC connection to addr
+type DialFunc func(addr string) (*rpc.Client, error)
+
+// HandshakeFunc is run on a freshly redialed connection before the neighbour counts as connected again
+type HandshakeFunc func(addr string, client *rpc.Client) error
+
+// PeerStatus is a snapshot of the connection to one neighbour
+type PeerStatus struct {
+	Addr      string
+	State     ConnState
+	Since     time.Time
+	Attempts  int
+	LastError string
+}
+
+type peer struct {
+	client    *rpc.Client
+	state     ConnState
+	since     time.Time
+	attempts  int
+	lastError string
+}
+
+// Manager tracks the connection to every neighbour
+type Manager struct {
+	sync.RWMutex
+	peers     map[string]*peer
+	dial      DialFunc
+	handshake HandshakeFunc
+	closed    bool
+	attempts  int // failed redials before giving up on a neighbour
+	logger    *logger.Logger
+}
+
+// NewManager creates a connection manager that redials lost neighbours with dial, then runs handshake on them
+func NewManager(dial DialFunc, handshake HandshakeFunc, log *logger.Logger) *Manager {
+	return &Manager{
+		peers:     make(map[string]*peer),
+		dial:      dial,
+		handshake: handshake,
+		attempts:  MAXATTEMPTS,
+		logger:    log,
+	}
+}
+
+// GiveUpAfter sets how many failed redials in a row make a lost neighbour be given up on, MAXATTEMPTS by default
+func (m *Manager) GiveUpAfter(attempts int) {
+	m.Lock()
+	defer m.Unlock()
+	m.attempts = attempts
+}
+
+// Dial opens a new connection to addr without tracking it
+func (m *Manager) Dial(addr string) (*rpc.Client, error) {
+	return m.dial(addr)
+}
+
+// Add records an established connection to addr. An older connection to the same neighbour is closed.
+func (m *Manager) Add(addr string, client *rpc.Client) {
+	m.Lock()
+	defer m.Unlock()
+	if m.closed {
+		client.Close()
+		return
+	}
+	p, ok := m.peers[addr]
+	if !ok {
+		p = &peer{}
+		m.peers[addr] = p
+	} else if p.client != nil && p.client != client {
+		p.client.Close()
+	}
+	p.client = client
+	p.state = Connected
+	p.since = time.Now()
+	p.attempts = 0
+	p.lastError = ""
+}
+
+// Disconnect closes the connection to addr and starts redialing it in the background
+func (m *Manager) Disconnect(addr string, reason string) {
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.peers[addr]
+	if !ok || m.closed || p.state != Connected {
+		return
+	}
+	m.logger.Debugf("[connmanager] lost %v: %v", addr, reason)
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+	p.state = Connecting
+	p.since = time.Now()
+	p.lastError = reason
+	go m.redial(addr)
+}
+
+// Remove forgets addr entirely, it will not be redialed
+func (m *Manager) Remove(addr string) {
+	m.Lock()
+	defer m.Unlock()
+	if p, ok := m.peers[addr]; ok {
+		if p.client != nil {
+			p.client.Close()
+		}
+		delete(m.peers, addr)
+	}
+}
+
+// Connected returns a snapshot of the connected neighbours, safe to range over while neighbours come and go
+func (m *Manager) Connected() map[string]*rpc.Client {
+	m.RLock()
+	defer m.RUnlock()
+	conns := make(map[string]*rpc.Client, len(m.peers))
+	for addr, p := range m.peers {
+		if p.state == Connected {
+			conns[addr] = p.client
+		}
+	}
+	return conns
+}
+
+// IsConnected reports whether addr is a connected neighbour
+func (m *Manager) IsConnected(addr string) bool {
+	m.RLock()
+	defer m.RUnlock()
+	p, ok := m.peers[addr]
+	return ok && p.state == Connected
+}
+
+// Status returns the state of every known neighbour, ordered by address
+func (m *Manager) Status() []PeerStatus {
+	m.RLock()
+	defer m.RUnlock()
+	status := make([]PeerStatus, 0, len(m.peers))
+	for addr, p := range m.peers {
+		status = append(status, PeerStatus{
+			Addr:      addr,
+			State:     p.state,
+			Since:     p.since,
+			Attempts:  p.attempts,
+			LastError: p.lastError,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Addr < status[j].Addr })
+	return status
+}
+
+// Close every connection and stop redialing
+func (m *Manager) Close() {
+	m.Lock()
+	defer m.Unlock()
+	m.closed = true
+	for addr, p := range m.peers {
+		if p.client != nil {
+			p.client.Close()
+		}
+		delete(m.peers, addr)
+	}
+}
+
+// redial keeps dialing addr with exponential backoff until it connects, is no longer wanted, or is given up on
+func (m *Manager) redial(addr string) {
+	backoff := MINBACKOFF
+	for {
+		time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2))))
+		if !m.startAttempt(addr) {
+			return
+		}
+
+		client, err := m.dial(addr)
+		if err == nil {
+			err = m.handshake(addr, client)
+			if err != nil {
+				client.Close()
+			}
+		}
+
+		m.Lock()
+		p, ok := m.peers[addr]
+		if !ok || m.closed || p.state != Connecting {
+			// removed, or reconnected by the neighbour itself in the meantime
+			m.Unlock()
+			if err == nil {
+				client.Close()
+			}
+			return
+		}
+		if err == nil {
+			p.client = client
+			p.state = Connected
+			p.since = time.Now()
+			p.attempts = 0
+			p.lastError = ""
+			m.Unlock()
+			m.logger.Debugf("[connmanager] reconnected to %v", addr)
+			return
+		}
+		p.lastError = err.Error()
+		if p.attempts >= m.attempts {
+			delete(m.peers, addr)
+			m.Unlock()
+			m.logger.Warnf("[connmanager] giving up on %v after %d redials: %v", addr, p.attempts, err)
+			return
+		}
+		m.Unlock()
+		m.logger.Debugf("[connmanager] redial %v failed: %v", addr, err)
+
+		backoff *= 2
+		if backoff > MAXBACKOFF {
+			backoff = MAXBACKOFF
+		}
+	}
+}
+
+// startAttempt counts a redial attempt, unless addr no longer needs redialing
+func (m *Manager) startAttempt(addr string) bool {
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.peers[addr]
+	if !ok || m.closed || p.state != Connecting {
+		return false
+	}
+	p.attempts++
+	return true
+}
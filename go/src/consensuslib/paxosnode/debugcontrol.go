@@ -0,0 +1,152 @@
+// this class exposes a PN's paxostracker controls and fault rules over RPC,
+// so breakpoints can be armed, continued and stepped, and faults injected, from anywhere in the cluster
+// it is only served by PNs that turn DebugControl on
+
+package paxosnode
+
+import (
+	"consensuslib/errors"
+	"consensuslib/paxosnode/faults"
+	"consensuslib/security"
+	"fmt"
+	"paxostracker/breakpoint"
+)
+
+// DebugControl is served next to the PaxosNodeRPCWrapper, one per connection.
+// When the cluster has a join token, a connection must first answer a challenge with it before anything else.
+type DebugControl struct {
+	paxosNode     *PaxosNode
+	authenticated bool
+}
+
+// RPC which hands a debug client a single-use challenge, to be answered with the join token
+func (d *DebugControl) Challenge(placeholder string, challenge *string) (err error) {
+	*challenge, err = d.paxosNode.challenges.Issue()
+	return err
+}
+
+// RPC which authenticates this connection with an answered challenge
+func (d *DebugControl) Authenticate(req security.JoinRequest, ok *bool) (err error) {
+	if err = d.paxosNode.sec.CheckJoinRequest(d.paxosNode.challenges, req); err != nil {
+		d.paxosNode.Logger.Warnf("[debugcontrol] refusing debug client %s: %s", req.Addr, err)
+		return errors.JoinRefusedError(err.Error())
+	}
+	d.authenticated = true
+	*ok = true
+	return nil
+}
+
+// RPC which arms a breakpoint, returning its ID
+func (d *DebugControl) Break(b breakpoint.Breakpoint, id *int) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	if !b.Stage.Valid() {
+		return fmt.Errorf("unknown stage '%s'", b.Stage)
+	}
+	b.ID = d.paxosNode.Tracker.Break(b)
+	*id = b.ID
+	d.paxosNode.Logger.Infof("[debugcontrol] armed breakpoint %v", b)
+	return nil
+}
+
+// RPC which lists the armed breakpoints
+func (d *DebugControl) Breakpoints(placeholder string, breakpoints *[]breakpoint.Breakpoint) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	*breakpoints = d.paxosNode.Tracker.Breakpoints()
+	return nil
+}
+
+// RPC which disarms the breakpoint with the given ID
+func (d *DebugControl) Delete(id int, ok *bool) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	if err = d.paxosNode.Tracker.Delete(id); err != nil {
+		return err
+	}
+	*ok = true
+	return nil
+}
+
+// RPC which reports where the PN is paused
+func (d *DebugControl) Paused(placeholder string, paused *[]breakpoint.Context) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	*paused = d.paxosNode.Tracker.Paused()
+	return nil
+}
+
+// RPC which continues every paused stage
+func (d *DebugControl) Continue(placeholder string, ok *bool) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	if err = d.paxosNode.Tracker.Continue(); err != nil {
+		return err
+	}
+	d.paxosNode.Logger.Info("[debugcontrol] continuing...")
+	*ok = true
+	return nil
+}
+
+// RPC which steps every paused stage to the next one
+func (d *DebugControl) Step(placeholder string, next *[]breakpoint.Stage) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	*next, err = d.paxosNode.Tracker.Step()
+	return err
+}
+
+// RPC which sets the fault rule for r.Peer, replacing any it had
+func (d *DebugControl) SetFault(r faults.Rule, ok *bool) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	d.paxosNode.Faults.Set(r)
+	d.paxosNode.Logger.Infof("[debugcontrol] injecting faults %v", r)
+	*ok = true
+	return nil
+}
+
+// RPC which lists the fault rules
+func (d *DebugControl) Faults(placeholder string, rules *[]faults.Rule) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	*rules = d.paxosNode.Faults.Rules()
+	return nil
+}
+
+// RPC which partitions the PN from every peer in peers
+func (d *DebugControl) Partition(peers []string, ok *bool) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	d.paxosNode.Faults.Partition(peers)
+	d.paxosNode.Logger.Infof("[debugcontrol] partitioned from %v", peers)
+	*ok = true
+	return nil
+}
+
+// RPC which removes the fault rules for peers, or every rule when peers is empty
+func (d *DebugControl) Heal(peers []string, ok *bool) (err error) {
+	if err = d.allowed(); err != nil {
+		return err
+	}
+	d.paxosNode.Faults.Heal(peers)
+	d.paxosNode.Logger.Infof("[debugcontrol] healed faults to %v", peers)
+	*ok = true
+	return nil
+}
+
+func (d *DebugControl) allowed() error {
+	if d.paxosNode.sec.JoinRequired() && !d.authenticated {
+		return errors.JoinRefusedError("debug client has not proven the join token")
+	}
+	return nil
+}
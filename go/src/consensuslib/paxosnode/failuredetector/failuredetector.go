@@ -0,0 +1,128 @@
+package failuredetector
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+/**
+ * Detector is a phi-accrual failure detector (Hayashibara et al.) fed by periodic peer-to-peer pings.
+ * Rather than answering alive/dead, it reports phi: how unlikely the current silence from a peer is,
+ * given the inter-arrival times of that peer's recent heartbeats. A phi of 1 means a 10% chance of
+ * being wrong about the peer having failed, 2 means 1%, 3 means 0.1%, and so on.
+ */
+
+// Detector tracks heartbeat history for every peer
+type Detector struct {
+	sync.Mutex
+	threshold       float64
+	windowSize      int
+	minStdDev       float64 // milliseconds
+	acceptablePause float64 // milliseconds
+	firstInterval   float64 // milliseconds
+	peers           map[string]*history
+	now             func() time.Time
+}
+
+// history is the sliding window of inter-arrival times for one peer
+type history struct {
+	intervals []float64 // milliseconds
+	last      time.Time
+}
+
+// NewDetector creates a detector that suspects a peer once its phi reaches threshold.
+// expectedInterval seeds the history of new peers, so they are not suspected before their first pings arrive.
+func NewDetector(threshold float64, windowSize int, expectedInterval, minStdDev, acceptablePause time.Duration) *Detector {
+	return &Detector{
+		threshold:       threshold,
+		windowSize:      windowSize,
+		minStdDev:       toMillis(minStdDev),
+		acceptablePause: toMillis(acceptablePause),
+		firstInterval:   toMillis(expectedInterval),
+		peers:           make(map[string]*history),
+		now:             time.Now,
+	}
+}
+
+// SetClock makes the detector tell the time with now rather than time.Now, e.g. to step through a silence in tests
+func (d *Detector) SetClock(now func() time.Time) {
+	d.Lock()
+	defer d.Unlock()
+	d.now = now
+}
+
+// Heartbeat records that the peer was heard from just now
+func (d *Detector) Heartbeat(peer string) {
+	d.Lock()
+	defer d.Unlock()
+	now := d.now()
+	h, ok := d.peers[peer]
+	if !ok {
+		// seed with a guess of the interval, and treat the first heartbeat as having just arrived
+		d.peers[peer] = &history{
+			intervals: []float64{d.firstInterval},
+			last:      now,
+		}
+		return
+	}
+	h.intervals = append(h.intervals, toMillis(now.Sub(h.last)))
+	if len(h.intervals) > d.windowSize {
+		h.intervals = h.intervals[len(h.intervals)-d.windowSize:]
+	}
+	h.last = now
+}
+
+// Phi returns the suspicion level of the peer. Peers that were never heard from have a phi of 0.
+func (d *Detector) Phi(peer string) float64 {
+	d.Lock()
+	defer d.Unlock()
+	h, ok := d.peers[peer]
+	if !ok {
+		return 0
+	}
+	return d.phi(h, toMillis(d.now().Sub(h.last)))
+}
+
+// Suspect reports whether the peer's phi has reached the threshold
+func (d *Detector) Suspect(peer string) bool {
+	return d.Phi(peer) >= d.threshold
+}
+
+// Remove forgets the peer's history, e.g. once it has been evicted
+func (d *Detector) Remove(peer string) {
+	d.Lock()
+	delete(d.peers, peer)
+	d.Unlock()
+}
+
+// phi uses the logistic approximation of the normal CDF, as in Akka's implementation
+func (d *Detector) phi(h *history, sinceLast float64) float64 {
+	mean, stdDev := meanAndStdDev(h.intervals)
+	mean += d.acceptablePause
+	stdDev = math.Max(stdDev, d.minStdDev)
+
+	y := (sinceLast - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if sinceLast > mean {
+		return -math.Log10(e / (1.0 + e))
+	}
+	return -math.Log10(1.0 - 1.0/(1.0+e))
+}
+
+func meanAndStdDev(samples []float64) (mean float64, stdDev float64) {
+	for _, s := range samples {
+		mean += s
+	}
+	mean /= float64(len(samples))
+	variance := 0.0
+	for _, s := range samples {
+		variance += (s - mean) * (s - mean)
+	}
+	variance /= float64(len(samples))
+	return mean, math.Sqrt(variance)
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,244 @@
+package faults
+
+import (
+	"consensuslib/errors"
+	"fmt"
+	"math/rand"
+	"net/rpc"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+ * Fault injection for the RPCs a PN makes to its neighbours, to simulate a lossy network without touching iptables.
+ * Each rule applies to the calls made to one peer, or to every peer without a rule of its own (ANYPEER):
+ *   drop N      N% of calls are lost before they are sent
+ *   dropreply N N% of calls are sent and handled by the peer, but its reply is lost
+ *   delay MS    calls are sent MS milliseconds late
+ *   duplicate   calls are sent twice, the second reply is discarded
+ *   partition   every call is lost before it is sent
+ * A lost call fails with a TimeoutError once the injector's timeout has passed since it was made, as it would on a
+ * real network, rather than straight away.
+ * Rules only affect the calls this PN makes. A call and its reply are one exchange, so a rule on PN A for peer B
+ * covers everything A asks of B, but not what B asks of A: partition both sides for a clean split.
+ */
+
+// ANYPEER is the peer of a rule for every peer without a rule of its own
+const ANYPEER = "*"
+
+// LOSTTIMEOUT is how long a lost call takes to fail, by default
+const LOSTTIMEOUT = 2 * time.Second
+
+// fate of a call
+type fate int
+
+const (
+	DELIVERED fate = iota
+	REQUESTLOST
+	REPLYLOST
+)
+
+// Rule is the faults injected into the calls made to Peer
+type Rule struct {
+	Peer             string
+	DropPercent      int
+	DropReplyPercent int
+	Delay            time.Duration
+	Duplicate        bool
+	Partitioned      bool
+}
+
+// Injector applies the fault rules to a PN's outgoing calls
+type Injector struct {
+	sync.Mutex
+	rules   map[string]Rule
+	rand    *rand.Rand
+	timeout time.Duration // for a lost call to fail
+}
+
+// NewInjector creates an injector without any rules, so calls go through untouched
+func NewInjector() *Injector {
+	return &Injector{
+		rules:   make(map[string]Rule),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		timeout: LOSTTIMEOUT,
+	}
+}
+
+// SetTimeout sets how long a lost call takes to fail
+func (in *Injector) SetTimeout(timeout time.Duration) {
+	in.Lock()
+	defer in.Unlock()
+	in.timeout = timeout
+}
+
+// Parse a rule from a peer followed by faults, e.g. "127.0.0.1:2001 drop 30 delay 100"
+func Parse(words []string) (r Rule, err error) {
+	if len(words) == 0 {
+		return r, fmt.Errorf("missing peer")
+	}
+	r.Peer = words[0]
+	for i := 1; i < len(words); i++ {
+		switch words[i] {
+		case "duplicate":
+			r.Duplicate = true
+			continue
+		case "partition":
+			r.Partitioned = true
+			continue
+		}
+		if i+1 >= len(words) {
+			return r, fmt.Errorf("missing argument to '%s'", words[i])
+		}
+		n, err := strconv.Atoi(words[i+1])
+		if err != nil || n < 0 {
+			return r, fmt.Errorf("bad number '%s' for '%s'", words[i+1], words[i])
+		}
+		switch words[i] {
+		case "drop", "dropreply":
+			if n > 100 {
+				return r, fmt.Errorf("cannot drop %d%% of calls", n)
+			}
+			if words[i] == "drop" {
+				r.DropPercent = n
+			} else {
+				r.DropReplyPercent = n
+			}
+		case "delay":
+			r.Delay = time.Duration(n) * time.Millisecond
+		default:
+			return r, fmt.Errorf("unknown fault '%s'", words[i])
+		}
+		i++
+	}
+	return r, nil
+}
+
+// Set the rule for r.Peer, replacing any it had
+func (in *Injector) Set(r Rule) {
+	in.Lock()
+	defer in.Unlock()
+	in.rules[r.Peer] = r
+}
+
+// Partition this PN from every peer in peers, keeping their other faults
+func (in *Injector) Partition(peers []string) {
+	in.Lock()
+	defer in.Unlock()
+	for _, peer := range peers {
+		r := in.rules[peer]
+		r.Peer = peer
+		r.Partitioned = true
+		in.rules[peer] = r
+	}
+}
+
+// Heal removes the rules for peers, or every rule and partition when no peers are given
+func (in *Injector) Heal(peers []string) {
+	in.Lock()
+	defer in.Unlock()
+	if len(peers) == 0 {
+		in.rules = make(map[string]Rule)
+	}
+	for _, peer := range peers {
+		delete(in.rules, peer)
+	}
+}
+
+// Rules returns every rule, ordered by peer
+func (in *Injector) Rules() []Rule {
+	in.Lock()
+	defer in.Unlock()
+	rules := make([]Rule, 0, len(in.rules))
+	for _, r := range in.rules {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Peer < rules[j].Peer
+	})
+	return rules
+}
+
+// Call method on the peer at peer through client, like client.Call, with the peer's faults applied
+func (in *Injector) Call(peer string, client *rpc.Client, method string, args interface{}, reply interface{}) error {
+	call := <-in.Go(peer, client, method, args, reply, make(chan *rpc.Call, 1)).Done
+	return call.Error
+}
+
+// Go calls method on the peer at peer through client, like client.Go, with the peer's faults applied
+func (in *Injector) Go(peer string, client *rpc.Client, method string, args interface{}, reply interface{}, done chan *rpc.Call) *rpc.Call {
+	if done == nil {
+		done = make(chan *rpc.Call, 1)
+	}
+	r, f, timeout := in.roll(peer)
+	if f == DELIVERED && r.Delay == 0 && !r.Duplicate {
+		return client.Go(method, args, reply, done)
+	}
+	call := &rpc.Call{ServiceMethod: method, Args: args, Reply: reply, Done: done}
+	go func() {
+		timedOut := time.After(timeout)
+		time.Sleep(r.Delay)
+		if r.Duplicate && f != REQUESTLOST {
+			// the copy's reply goes nowhere, only the receiver sees the message twice
+			client.Go(method, args, newReply(reply), make(chan *rpc.Call, 1))
+		}
+		switch f {
+		case DELIVERED:
+			call.Error = client.Call(method, args, reply)
+			done <- call
+			return
+		case REPLYLOST:
+			// the peer handles the call, but the caller never hears back
+			client.Go(method, args, newReply(reply), make(chan *rpc.Call, 1))
+		}
+		<-timedOut
+		call.Error = errors.TimeoutError(method + " to " + peer)
+		done <- call
+	}()
+	return call
+}
+
+// roll returns the rule for peer, the fate of this call to it and how long the call takes to fail if lost
+func (in *Injector) roll(peer string) (r Rule, f fate, timeout time.Duration) {
+	in.Lock()
+	defer in.Unlock()
+	r, ok := in.rules[peer]
+	if !ok {
+		r = in.rules[ANYPEER]
+	}
+	switch {
+	case r.Partitioned || (r.DropPercent > 0 && in.rand.Intn(100) < r.DropPercent):
+		f = REQUESTLOST
+	case r.DropReplyPercent > 0 && in.rand.Intn(100) < r.DropReplyPercent:
+		f = REPLYLOST
+	}
+	return r, f, in.timeout
+}
+
+// newReply allocates a reply of the same type as reply, for a duplicate call to decode into
+func newReply(reply interface{}) interface{} {
+	return reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+}
+
+func (r Rule) String() string {
+	desc := r.Peer + ":"
+	if r.Partitioned {
+		desc += " partitioned"
+	}
+	if r.DropPercent > 0 {
+		desc += fmt.Sprintf(" drop %d%%", r.DropPercent)
+	}
+	if r.DropReplyPercent > 0 {
+		desc += fmt.Sprintf(" drop %d%% of replies", r.DropReplyPercent)
+	}
+	if r.Delay > 0 {
+		desc += fmt.Sprintf(" delay %v", r.Delay)
+	}
+	if r.Duplicate {
+		desc += " duplicate"
+	}
+	return desc
+}
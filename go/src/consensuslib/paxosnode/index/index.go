@@ -0,0 +1,166 @@
+package index
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/*
+	A full-text index of the learned log, kept in memory by the learner. Values are split into terms at every character
+	that is not a letter or digit, and terms are lower-cased, so "Dear Diary!" has the terms dear and diary.
+	A search finds the slots whose values have every term of the query, oldest first.
+	Nothing is saved: the index is rebuilt from whatever log the learner is initialised with, on joining or from a
+	trace's snapshot.
+*/
+
+// SNIPPETWORDS is how many words are kept around the first match in a snippet, on either side
+const SNIPPETWORDS = 5
+
+// Hit is a slot whose value matched a search
+type Hit struct {
+	Slot    int
+	Snippet string // the value around its first match, cut short with "..."
+}
+
+// Index of the terms in the values of a log
+type Index struct {
+	sync.RWMutex
+	postings map[string][]int // slots each term is in, in increasing order
+	values   []string         // by slot
+}
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{postings: make(map[string][]int)}
+}
+
+// Add the value learned at slot. Slots are added in order, adding one again replaces its value.
+func (ix *Index) Add(slot int, value string) {
+	ix.Lock()
+	defer ix.Unlock()
+	if slot < len(ix.values) {
+		values := append([]string(nil), ix.values...)
+		values[slot] = value
+		ix.rebuild(values)
+		return
+	}
+	for len(ix.values) < slot {
+		ix.values = append(ix.values, "")
+	}
+	ix.values = append(ix.values, value)
+	ix.add(slot, value)
+}
+
+// Rebuild the index from the values of a whole log, by slot
+func (ix *Index) Rebuild(values []string) {
+	ix.Lock()
+	defer ix.Unlock()
+	ix.rebuild(values)
+}
+
+func (ix *Index) rebuild(values []string) {
+	ix.postings = make(map[string][]int)
+	ix.values = append([]string(nil), values...)
+	for slot, value := range ix.values {
+		ix.add(slot, value)
+	}
+}
+
+func (ix *Index) add(slot int, value string) {
+	seen := make(map[string]bool)
+	for _, term := range Terms(value) {
+		if !seen[term] {
+			seen[term] = true
+			ix.postings[term] = append(ix.postings[term], slot)
+		}
+	}
+}
+
+// Len of the log indexed
+func (ix *Index) Len() int {
+	ix.RLock()
+	defer ix.RUnlock()
+	return len(ix.values)
+}
+
+// Search for the slots whose values have every term of query, oldest first.
+// A query without terms matches nothing.
+func (ix *Index) Search(query string) (hits []Hit) {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	ix.RLock()
+	defer ix.RUnlock()
+	slots := ix.postings[terms[0]]
+	for _, term := range terms[1:] {
+		slots = intersect(slots, ix.postings[term])
+	}
+	for _, slot := range slots {
+		hits = append(hits, Hit{Slot: slot, Snippet: snippet(ix.values[slot], terms)})
+	}
+	return hits
+}
+
+// Terms of text, lower-cased, in the order they appear
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// intersect two increasing lists of slots
+func intersect(a []int, b []int) (both []int) {
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			both = append(both, a[i])
+			i++
+			j++
+		}
+	}
+	return both
+}
+
+// snippet of value, the words around the first one with a term of terms
+func snippet(value string, terms []string) string {
+	words := strings.Fields(value)
+	first := 0
+	for i, word := range words {
+		if hasAny(Terms(word), terms) {
+			first = i
+			break
+		}
+	}
+	from, to := first-SNIPPETWORDS, first+SNIPPETWORDS+1
+	s := ""
+	if from <= 0 {
+		from = 0
+	} else {
+		s = "..."
+	}
+	if to > len(words) {
+		to = len(words)
+	}
+	s += strings.Join(words[from:to], " ")
+	if to < len(words) {
+		s += "..."
+	}
+	return s
+}
+
+func hasAny(terms []string, wanted []string) bool {
+	for _, t := range terms {
+		for _, w := range wanted {
+			if t == w {
+				return true
+			}
+		}
+	}
+	return false
+}
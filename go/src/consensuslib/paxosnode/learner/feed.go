@@ -0,0 +1,69 @@
+package learner
+
+import (
+	"sync"
+)
+
+// feed wakes the followers of a learner's log when it grows, see LearnerRole.Follow
+type feed struct {
+	sync.Mutex
+	learned *sync.Cond
+	log     []Message // the learner's log as last published, values below its length never change
+}
+
+func newFeed() *feed {
+	f := &feed{}
+	f.learned = sync.NewCond(f)
+	return f
+}
+
+// publish the learner's log to its followers
+func (f *feed) publish(log []Message) {
+	f.Lock()
+	f.log = log
+	f.Unlock()
+	f.learned.Broadcast()
+}
+
+// Follow calls learned with each value in the log from slot from on, in slot order, and then with each value as it is
+// learned, until done is closed. It blocks, and never holds up learning: a slow follower only falls behind.
+// A negative from follows from slot 0.
+func (l *LearnerRole) Follow(from int, done <-chan struct{}, learned func(slot int, m Message)) {
+	if from < 0 {
+		from = 0
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-done:
+			// taking the lock, so the follower is either checking done or waiting to be woken
+			l.feed.Lock()
+			l.feed.Unlock()
+			l.feed.learned.Broadcast()
+		case <-stop:
+		}
+	}()
+	for next := from; ; next++ {
+		l.feed.Lock()
+		for next >= len(l.feed.log) && !isClosed(done) {
+			l.feed.learned.Wait()
+		}
+		if isClosed(done) {
+			l.feed.Unlock()
+			return
+		}
+		m := l.feed.log[next]
+		l.feed.Unlock()
+		learned(next, m)
+	}
+}
+
+func isClosed(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
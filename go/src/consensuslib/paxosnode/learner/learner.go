@@ -3,9 +3,14 @@ package learner
 import (
 	"consensuslib/errors"
 	"consensuslib/message"
-	"filelogger/singletonlogger"
+	"consensuslib/paxosnode/backup"
+	"consensuslib/paxosnode/index"
+	"encoding/json"
+	"filelogger/logger"
 	"fmt"
 	"paxostracker"
+	"paxostracker/breakpoint"
+	"sync"
 )
 
 type Message = message.Message
@@ -16,9 +21,16 @@ type MessageAccepted struct {
 }
 
 type LearnerRole struct {
+	ID           string // of the PN, names the file the log is saved to
 	Accepted     *SyncLog
 	Log          []Message
 	CurrentRound int // Should start at 0
+	Tracker      *paxostracker.PaxosTracker
+	Index        *index.Index // of the terms in the values learned, for searching them
+	learning     *sync.Mutex  // one value is learned at a time, so a value paused before learning is not learned twice
+	logger       *logger.Logger
+	feed         *feed           // of the values learned, to their followers
+	saved        *backup.Journal // of the log, one value per line
 }
 
 type LearnerInterface interface {
@@ -30,9 +42,18 @@ type LearnerInterface interface {
 	// the network and learns of the majority log state from other PNs
 	InitializeLog(log []Message) (err error)
 
+	// Restores the log saved by an earlier run of this PN, and indexes it, so that a PN restarting alone keeps its log
+	RestoreFromBackup()
+
 	// Get this learner's current version of the PN log
 	GetCurrentLog() (log []Message, err error)
 
+	// Get the values in slots from up to, but not including, to, stopping at the end of the log
+	GetRange(from, to int) (log []Message, err error)
+
+	// Get the number of values learned
+	Len() int
+
 	// Get the number of times this particular message ID has been accepted by this Learner
 	NumAlreadyAccepted(m *Message) int
 
@@ -41,24 +62,66 @@ type LearnerInterface interface {
 	LearnValue(m *Message) (currentRoundIndex int, err error)
 }
 
-func NewLearner() LearnerRole {
+// NewLearner creates a learner for the PN with the given ID that reports the rounds it learns to tracker, logging to log
+func NewLearner(id string, tracker *paxostracker.PaxosTracker, log *logger.Logger) LearnerRole {
 	syncLog := NewSyncLog()
-	learner := LearnerRole{Accepted: syncLog, Log: make([]Message, 0), CurrentRound: 0}
+	learner := LearnerRole{ID: id, Accepted: syncLog, Log: make([]Message, 0), CurrentRound: 0, Tracker: tracker, learning: &sync.Mutex{}, logger: log, feed: newFeed(), Index: index.NewIndex(),
+		saved: backup.NewJournal(backup.Path(id, backup.LEARNED))}
 	return learner
 }
 
 func (l *LearnerRole) InitializeLog(log []Message) (err error) {
-	singletonlogger.Debug(fmt.Sprintf("[learner] Initializing log with size %v", len(log)))
+	l.logger.Debugf("[learner] Initializing log with size %v", len(log))
 	l.Log = log
 	l.CurrentRound = len(log)
-	singletonlogger.Debug(fmt.Sprintf("[learner] Initializing next round %v", l.CurrentRound))
+	l.logger.Debugf("[learner] Initializing next round %v", l.CurrentRound)
+	l.saveLog()
+	l.Index.Rebuild(values(log))
+	l.feed.publish(l.Log)
 	return nil
 }
 
+func (l *LearnerRole) RestoreFromBackup() {
+	log := make([]Message, 0)
+	err := backup.ReadJSONLines(backup.Path(l.ID, backup.LEARNED), func(line []byte) error {
+		var m Message
+		err := json.Unmarshal(line, &m)
+		log = append(log, m)
+		return err
+	})
+	if err != nil {
+		l.logger.Debugf("[learner] no log restored: %v", err)
+		return
+	}
+	l.logger.Debugf("[learner] Restoring log with size %v", len(log))
+	l.Log = log
+	l.CurrentRound = len(log)
+	l.Index.Rebuild(values(log))
+	l.feed.publish(l.Log)
+}
+
 func (l *LearnerRole) GetCurrentLog() ([]Message, error) {
 	return l.Log, nil
 }
 
+func (l *LearnerRole) GetRange(from, to int) ([]Message, error) {
+	if from < 0 || from > to {
+		return nil, errors.InvalidLogRangeError(fmt.Sprintf("[%d, %d)", from, to))
+	}
+	log := l.Log
+	if to > len(log) {
+		to = len(log)
+	}
+	if from >= to {
+		return []Message{}, nil
+	}
+	return log[from:to], nil
+}
+
+func (l *LearnerRole) Len() int {
+	return len(l.Log)
+}
+
 func (l *LearnerRole) NumAlreadyAccepted(m *Message) int {
 	if accepted, ok := l.Accepted.Load(m.ID); ok {
 		accepted.Times++
@@ -70,8 +133,9 @@ func (l *LearnerRole) NumAlreadyAccepted(m *Message) int {
 }
 
 func (l *LearnerRole) LearnValue(m *Message) (currentRoundIndex int, err error) {
-	paxostracker.Learn(uint64(currentRoundIndex))
-	singletonlogger.Debug(fmt.Sprintf("[learner] Writing value'%v'to round %v", m.Value, l.CurrentRound))
+	l.learning.Lock()
+	defer l.learning.Unlock()
+	l.logger.Debugf("[learner] Writing value'%v'to round %v", m.Value, l.CurrentRound)
 	if len(l.Log) > l.CurrentRound {
 		// Since Learner manages this state, this should theoretically never happen...
 		return l.CurrentRound, errors.ValueForRoundInLogExistsError(l.CurrentRound)
@@ -79,9 +143,17 @@ func (l *LearnerRole) LearnValue(m *Message) (currentRoundIndex int, err error)
 		if l.inLog(m) {
 			return m.RoundNum + 1, nil
 		}
+		checkpoint := breakpoint.Context{Round: m.RoundNum, ID: m.ID, Value: m.Value, Peer: m.FromProposerID}
+		l.Tracker.Learn(checkpoint)
 		l.Log = append(l.Log, *m)
-		singletonlogger.Debug(fmt.Sprintf("[learner] Wrote value %v to log at index %v", l.Log[l.CurrentRound], l.CurrentRound))
-		paxostracker.Idle(l.Log[l.CurrentRound].Value)
+		l.logger.Debugf("[learner] Wrote value %v to log at index %v", l.Log[l.CurrentRound], l.CurrentRound)
+		if err := l.saved.Append(m); err != nil {
+			l.logger.Debugf("[learner] errored on saving value %v", err)
+		}
+		l.Index.Add(l.CurrentRound, m.Value)
+		l.feed.publish(l.Log)
+		l.Tracker.Learned(m.RoundNum)
+		l.Tracker.Idle(checkpoint)
 		l.CurrentRound++
 		newInd := m.RoundNum + 1
 		return newInd, nil
@@ -96,3 +168,28 @@ func (l *LearnerRole) inLog(m *Message) bool {
 	}
 	return false
 }
+
+// values of the messages in log, by slot
+func values(log []Message) []string {
+	values := make([]string, len(log))
+	for i, m := range log {
+		values[i] = m.Value
+	}
+	return values
+}
+
+// saves the whole log to disk, for offline safety checks. Values learned later are appended to it.
+func (l *LearnerRole) saveLog() {
+	log := make([]interface{}, len(l.Log))
+	for i, m := range l.Log {
+		log[i] = m
+	}
+	if err := l.saved.Replace(log); err != nil {
+		l.logger.Debugf("[learner] errored on saving log %v", err)
+	}
+}
+
+// Close the saved log, e.g. when the PN is unmounted
+func (l *LearnerRole) Close() error {
+	return l.saved.Close()
+}
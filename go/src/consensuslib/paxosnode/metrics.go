@@ -0,0 +1,44 @@
+package paxosnode
+
+import (
+	"metrics"
+)
+
+// Metrics of a PN, on a registry of its own so several PNs in one process are counted apart
+type Metrics struct {
+	Registry *metrics.Registry
+
+	ProposalsStarted   *metrics.Counter // every attempt, retries included
+	ProposalsCommitted *metrics.Counter
+	ProposalsRetried   *metrics.Counter
+	PrepareLatency     *metrics.Histogram
+	AcceptLatency      *metrics.Histogram
+	PrepareNacks       *metrics.Counter
+	AcceptNacks        *metrics.Counter
+	LogLength          *metrics.Gauge
+	Evictions          *metrics.Counter
+}
+
+// newMetrics registers the metrics of pn
+func newMetrics(pn *PaxosNode) *Metrics {
+	r := metrics.NewRegistry()
+	m := &Metrics{
+		Registry: r,
+
+		ProposalsStarted:   r.Counter("paxos_proposals_started_total", "Proposals this node started, each retry included.", nil),
+		ProposalsCommitted: r.Counter("paxos_proposals_committed_total", "Proposals of this node accepted by a majority.", nil),
+		ProposalsRetried:   r.Counter("paxos_proposals_retried_total", "Proposals of this node retried for lack of a majority.", nil),
+		PrepareLatency: r.Histogram("paxos_prepare_duration_seconds",
+			"Time from sending a prepare request until every neighbour answered or timed out.", nil, metrics.LATENCYBUCKETS),
+		AcceptLatency: r.Histogram("paxos_accept_duration_seconds",
+			"Time from sending an accept request until every neighbour answered or timed out.", nil, metrics.LATENCYBUCKETS),
+		PrepareNacks: r.Counter("paxos_nacks_total", "Replies refusing this node's requests.", metrics.Labels{"phase": "prepare"}),
+		AcceptNacks:  r.Counter("paxos_nacks_total", "Replies refusing this node's requests.", metrics.Labels{"phase": "accept"}),
+		LogLength:    r.Gauge("paxos_learned_log_length", "Values in this node's learned log.", nil),
+		Evictions:    r.Counter("paxos_neighbour_evictions_total", "Neighbours taken out of the rounds as failed.", nil),
+	}
+	r.GaugeFunc("paxos_neighbours", "Neighbours connected and taking part in the rounds.", nil, func() float64 {
+		return float64(len(pn.neighbours()))
+	})
+	return m
+}
@@ -4,14 +4,22 @@ import (
 	"consensuslib/errors"
 	"consensuslib/message"
 	"consensuslib/paxosnode/acceptor"
+	"consensuslib/paxosnode/connmanager"
+	"consensuslib/paxosnode/failuredetector"
+	"consensuslib/paxosnode/faults"
 	"consensuslib/paxosnode/learner"
 	"consensuslib/paxosnode/proposer"
-	"filelogger/singletonlogger"
+	"consensuslib/paxosnode/trace"
+	"consensuslib/security"
+	"filelogger/logger"
+	"filelogger/vclock"
 	"fmt"
 	"math/rand"
 	"net/rpc"
 	"paxostracker"
+	"paxostracker/breakpoint"
 	"regexp"
+	"sort"
 	"sync"
 	"time"
 )
@@ -43,33 +51,88 @@ const RANDOFFSET = 3
 // TTL for message
 const TTL = 3
 
+// PINGINTERVAL is how often neighbours are pinged to feed the failure detector
+const PINGINTERVAL = 500 * time.Millisecond
+
+// PHITHRESHOLD is the suspicion level at which a neighbour is treated as failed
+const PHITHRESHOLD = 8.0
+
+// PHIWINDOW is the number of ping inter-arrival times the failure detector remembers per neighbour
+const PHIWINDOW = 100
+
+// PHIMINSTDDEV keeps a perfectly regular ping history from making the detector hair-triggered
+const PHIMINSTDDEV = 100 * time.Millisecond
+
+// PHIPAUSE is the extra silence tolerated on top of the usual ping interval, e.g. for GC pauses
+const PHIPAUSE = 1 * time.Second
+
 // PaxosNode struct
 type PaxosNode struct {
 	Addr             string // IP:port, identifier
 	Proposer         ProposerRole
 	Acceptor         AcceptorRole
 	Learner          LearnerRole
-	NbrAddrs         []string
-	Neighbours       map[string]*rpc.Client
+	Conns            *connmanager.Manager
 	FailedNeighbours []string
 	RoundNum         int
+	Detector         *failuredetector.Detector
+	Tracker          *paxostracker.PaxosTracker
+	Faults           *faults.Injector // applied to every call to a neighbour but GetRounds
+	Trace            *trace.Recorder  // nil unless the PN's messages are being recorded
+	VClock           *vclock.Logger   // nil unless the PN's process logs vector clocks
+	DebugControl     bool             // serve DebugControl to debug clients on the PN's port, off by default
+	Logger           *logger.Logger   // of the PN and its roles
+	Metrics          *Metrics
+
+	sec         *security.Config
+	challenges  *security.Challenges
+	failedLock  sync.Mutex
+	counting    sync.Mutex // notices are counted one at a time, so that a step stops at each
+	stopPinging chan struct{}
+	unmount     sync.Once
 }
 
-// NewPaxosNode creates a Paxos Node that is linked to the client. The PN's Addr field is set as the pnAddr passed in
-func NewPaxosNode(pnAddr string) (pn *PaxosNode, err error) {
-	proposer := proposer.NewProposer(pnAddr)
+// NewPaxosNode creates a Paxos Node that is linked to the client. The PN's Addr field is set as the pnAddr passed in.
+// When sec has TLS, connections to neighbours are made with mutual TLS.
+// When sec has a JoinToken, new neighbours must prove they know it before they are connected back to.
+// The PN logs to log, or nowhere when log is nil.
+func NewPaxosNode(pnAddr string, sec *security.Config, log *logger.Logger) (pn *PaxosNode, err error) {
+	if log == nil {
+		log = logger.NewDiscardLogger("paxosnode" + pnAddr)
+	}
 	acceptorID := portRegex.FindString(pnAddr)
-	acceptor := acceptor.NewAcceptor(acceptorID)
-	learner := learner.NewLearner()
+	proposer := proposer.NewProposer(pnAddr, acceptorID, log)
+	acceptor := acceptor.NewAcceptor(acceptorID, log)
+	tracker := paxostracker.NewPaxosTracker(pnAddr, log)
+	learner := learner.NewLearner(acceptorID, tracker, log)
 	pn = &PaxosNode{
 		Addr:     pnAddr,
 		Proposer: proposer,
 		Acceptor: acceptor,
 		Learner:  learner,
+		Detector: failuredetector.NewDetector(PHITHRESHOLD, PHIWINDOW, PINGINTERVAL, PHIMINSTDDEV, PHIPAUSE),
+		Tracker:  tracker,
+		Faults:   faults.NewInjector(),
+		Logger:   log,
+
+		sec:         sec,
+		challenges:  security.NewChallenges(),
+		stopPinging: make(chan struct{}),
 	}
+	pn.Conns = connmanager.NewManager(pn.dial, pn.introduce, log)
+	pn.Metrics = newMetrics(pn)
+	go pn.PingNeighbours()
 	acceptor.RestoreFromBackup()
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] after backup restoration promised value is %v", acceptor.LastPromised))
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] after backup restoration accepted value is %v", acceptor.LastAccepted))
+	log.Debugf("[paxosnode] after backup restoration promised value is %v", acceptor.LastPromised)
+	log.Debugf("[paxosnode] after backup restoration accepted value is %v", acceptor.LastAccepted)
+	pn.Learner.RestoreFromBackup()
+	if restored := pn.Learner.Log; len(restored) != 0 {
+		// carry on from the restored log, even without neighbours to learn it from
+		pn.RoundNum = restored[len(restored)-1].RoundNum + 1
+		pn.Proposer.UpdateMessageID(restored[len(restored)-1].ID)
+		pn.Metrics.LogLength.Set(float64(len(restored)))
+		log.Debugf("[paxosnode] after backup restoration the log has %v values", len(restored))
+	}
 	return pn, err
 }
 
@@ -79,89 +142,94 @@ func (pn *PaxosNode) LearnLatestValueFromNeighbours() (err error) {
 	return err
 }
 
-// UnmountPaxosNode closes all RPC connections with neighbours nicely
+// UnmountPaxosNode closes all RPC connections with neighbours nicely. Unmounting again does nothing.
 func (pn *PaxosNode) UnmountPaxosNode() (err error) {
-	for _, conn := range pn.Neighbours {
-		conn.Close()
-	}
-	pn.NbrAddrs = nil
-
+	pn.unmount.Do(func() {
+		close(pn.stopPinging)
+		pn.Conns.Close()
+		pn.Trace.Close()
+		pn.Acceptor.Close()
+		pn.Proposer.Close()
+		pn.Learner.Close()
+	})
 	return nil
 }
 
 // WriteToPaxosNode Handles the entire process of proposing a value and trying to achieve consensus
 func (pn *PaxosNode) WriteToPaxosNode(value, msgHash string, ttl int) (success bool, err error) {
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] Writing to paxos %v TTL: %v", value, ttl))
+	pn.Logger.Debugf("[paxosnode] Writing to paxos %v TTL: %v", value, ttl)
+	pn.Metrics.ProposalsStarted.Inc()
+	pn.VClock.LocalEvent(fmt.Sprintf("proposing '%s' in round %d", value, pn.RoundNum))
 	prepReq := pn.Proposer.CreatePrepareRequest(pn.RoundNum, msgHash, ttl)
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] Prepare request is id: %d , val: %s, type: %d, round: %d \n", prepReq.ID, prepReq.Value, prepReq.Type, prepReq.RoundNum))
+	pn.logAbout(&prepReq, pn.Addr, trace.PREPARE).Debugf("[paxosnode] Prepare request is id: %d , val: %s, type: %d, round: %d", prepReq.ID, prepReq.Value, prepReq.Type, prepReq.RoundNum)
 	numAccepted, err := pn.DisseminateRequest(prepReq)
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] Pledged to accept %v", numAccepted))
+	pn.logAbout(&prepReq, pn.Addr, trace.PREPARE).Debugf("[paxosnode] Pledged to accept %v", numAccepted)
 	if err != nil {
-		singletonlogger.Error(err.Error())
+		pn.Logger.Error(err.Error())
 		return false, err
 	}
 
 	// If majority is not reached, sleep for a while and try again
 	b, e := pn.ShouldRetry(numAccepted, value, &prepReq)
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] returned from should retry positively %v \n", b))
+	pn.Logger.Debugf("[paxosnode] returned from should retry positively %v \n", b)
 	if b {
 		return b, e
 	}
 
 	accReq := pn.Proposer.CreateAcceptRequest(value, msgHash, pn.RoundNum, prepReq.Bounces)
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] Accept request is id: %d , val: %s, type: %d \n", accReq.ID, accReq.Value, accReq.Type))
-	paxostracker.Propose(accReq.ID)
+	pn.logAbout(&accReq, pn.Addr, trace.ACCEPT).Debugf("[paxosnode] Accept request is id: %d , val: %s, type: %d", accReq.ID, accReq.Value, accReq.Type)
+	pn.Tracker.Propose(checkpointOf(&accReq))
 	numAccepted, err = pn.DisseminateRequest(accReq)
 	if err != nil {
 		return false, err
 	}
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] Accepted %v", numAccepted))
+	pn.logAbout(&accReq, pn.Addr, trace.ACCEPT).Debugf("[paxosnode] Accepted %v", numAccepted)
 	// If majority is not reached, sleep for a while and try again
 	b, e = pn.ShouldRetry(numAccepted, value, &accReq)
 	if b {
 		return b, e
 	}
 
+	pn.Metrics.ProposalsCommitted.Inc()
 	return true, nil
 }
 
 // BecomeNeighbours sets up bidirectional RPC with all neighbours
 func (pn *PaxosNode) BecomeNeighbours(ips []string) (err error) {
 	for _, ip := range ips {
-		neighbourConn, err := rpc.Dial("tcp", ip)
+		neighbourConn, err := pn.dial(ip)
 		if err != nil {
-			singletonlogger.Debug("[paxosnode]: Error in BecomeNeighbours")
+			pn.Logger.Debug("[paxosnode]: Error in BecomeNeighbours")
 			return errors.NeighbourConnectionError(ip)
 		}
-		connected := false
-		err = neighbourConn.Call("PaxosNodeRPCWrapper.ConnectRemoteNeighbour", pn.Addr, &connected)
-		// Add ip to connectedNbrs and add the connection to Neighbours map
+		// Add the connection to the connection manager
 		// after bidirectional RPC connection establishment is successful
-		if connected {
-			singletonlogger.Debug("[paxosnode]: connected to the nbr")
-			pn.NbrAddrs = append(pn.NbrAddrs, ip)
-			if pn.Neighbours == nil {
-				pn.Neighbours = make(map[string]*rpc.Client, 0)
-			}
-			pn.Neighbours[ip] = neighbourConn
+		err = pn.introduce(ip, neighbourConn)
+		if err != nil {
+			pn.Logger.Debugf("[paxosnode]: %v", err)
+			neighbourConn.Close()
+			continue
 		}
+		pn.Logger.Debug("[paxosnode]: connected to the nbr")
+		pn.Conns.Add(ip, neighbourConn)
 	}
 	return nil
 }
 
 // SetInitialLog when a new node joins the network by contacting all of its neighbours for their logs.
-// The new node will then set its initial log to be the longest log received from neighbours
+// The new node will then set its initial log to be the longest log received from neighbours, or its own restored
+// log if none is longer
 func (pn *PaxosNode) SetInitialLog() (err error) {
-	singletonlogger.Debug("[paxosnode] Setting the initial log for this new node")
-	maxLen := 0
-	longestLog := make([]Message, 0)
-	for k, v := range pn.Neighbours {
+	pn.Logger.Debug("[paxosnode] Setting the initial log for this new node")
+	longestLog := pn.Learner.Log
+	maxLen := len(longestLog)
+	for k, v := range pn.neighbours() {
 		// Create a temporary log to get filled by neighbour learners
 		temp := make([]Message, 0)
-		singletonlogger.Debug(fmt.Sprintf("[paxosnode] Making ReadFromLearner call to node %v\n", v))
-		e := v.Call("PaxosNodeRPCWrapper.ReadFromLearner", "placeholder", &temp)
+		pn.Logger.Debugf("[paxosnode] Making ReadFromLearner call to node %v\n", v)
+		e := pn.Faults.Call(k, v, "PaxosNodeRPCWrapper.ReadFromLearner", "placeholder", &temp)
 		if e != nil {
-			pn.RemoveFailedNeighbour(k)
+			pn.SuspectNeighbour(k)
 			continue
 		}
 		if len(temp) > maxLen {
@@ -170,6 +238,8 @@ func (pn *PaxosNode) SetInitialLog() (err error) {
 		}
 	}
 	pn.Learner.InitializeLog(longestLog)
+	pn.Metrics.LogLength.Set(float64(len(longestLog)))
+	pn.Trace.Record(trace.Event{Clock: pn.Trace.Tick(), Direction: trace.LOCAL, Kind: trace.LOG, Round: pn.RoundNum, Log: longestLog})
 
 	// Set a new messageId to a newly joined node to accommodate the same PSN across PaxosNW
 	logLen := len(longestLog)
@@ -192,36 +262,64 @@ func (pn *PaxosNode) GetLog() (log []Message, err error) {
 	return log, err
 }
 
+// GetLogRange of the pn's learner, the values in slots from up to, but not including, to
+func (pn *PaxosNode) GetLogRange(from, to int) (log []Message, err error) {
+	return pn.Learner.GetRange(from, to)
+}
+
+// GetLogLength of the pn's learner
+func (pn *PaxosNode) GetLogLength() int {
+	return pn.Learner.Len()
+}
+
+// ReadRangeFromNeighbour asks the learner of the neighbour at addr for the values in slots from up to, but not
+// including, to
+func (pn *PaxosNode) ReadRangeFromNeighbour(addr string, from, to int) (log []Message, err error) {
+	conn, ok := pn.neighbours()[addr]
+	if !ok {
+		return nil, fmt.Errorf("[paxosnode] %s is not a connected neighbour", addr)
+	}
+	err = pn.Faults.Call(addr, conn, "PaxosNodeRPCWrapper.ReadRangeFromLearner", LogRange{From: from, To: to}, &log)
+	if err != nil {
+		return nil, fmt.Errorf("[paxosnode] unable to read [%d, %d) from %s: %s", from, to, addr, err)
+	}
+	return log, nil
+}
+
 // AcceptNeighbourConnection sets up the bi-directional RPC. A new PN joins the network and will
 // establish an RPC connection with each of the other PNs
-func (pn *PaxosNode) AcceptNeighbourConnection(addr string, result *bool) (err error) {
-	neighbourConn, err := rpc.Dial("tcp", addr)
+func (pn *PaxosNode) AcceptNeighbourConnection(req security.JoinRequest, result *bool) (err error) {
+	addr := req.Addr
+	if err = pn.sec.CheckJoinRequest(pn.challenges, req); err != nil {
+		pn.Logger.Warnf("[paxosnode] refusing neighbour %s: %s", addr, err)
+		return errors.JoinRefusedError(err.Error())
+	}
+	neighbourConn, err := pn.dial(addr)
 	if err != nil {
-		singletonlogger.Debug("[paxosnode] Error in AcceptNeighbourConnection")
+		pn.Logger.Debug("[paxosnode] Error in AcceptNeighbourConnection")
 		return errors.NeighbourConnectionError(addr)
 	}
-	pn.NbrAddrs = append(pn.NbrAddrs, addr)
-	if pn.Neighbours == nil {
-		pn.Neighbours = make(map[string]*rpc.Client, 0)
-	}
-	pn.Neighbours[addr] = neighbourConn
+	pn.Conns.Add(addr, neighbourConn)
+	pn.Detector.Heartbeat(addr)
 
 	neighbors := ""
-	for _, n := range pn.Neighbours {
+	nbrs := pn.neighbours()
+	for _, n := range nbrs {
 		neighbors += fmt.Sprintf("%v ", n)
 	}
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] after neigh connection we have length '%v' and neighbours %v", len(pn.Neighbours), neighbors))
+	pn.Logger.Debugf("[paxosnode] after neigh connection we have length '%v' and neighbours %v", len(nbrs), neighbors)
 	*result = true
 	return nil
 }
 
 // DisseminateRequest sends a message to all neighbours. This includes prepare and accept requests.
 func (pn *PaxosNode) DisseminateRequest(prepReq Message) (numAccepted int, err error) {
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] Disseminate request %v", prepReq.Type))
+	pn.Logger.Debugf("[paxosnode] Disseminate request %v", prepReq.Type)
 	numAccepted = 0
 	switch prepReq.Type {
 	case message.PREPARE:
-		singletonlogger.Debug("[paxosnode] PREPARE")
+		pn.Logger.Debug("[paxosnode] PREPARE")
+		defer pn.Metrics.PrepareLatency.ObserveSince(time.Now())
 
 		// Set up timer and channel for responses
 		timer := time.NewTimer(TIMER)
@@ -230,103 +328,132 @@ func (pn *PaxosNode) DisseminateRequest(prepReq Message) (numAccepted int, err e
 			<-timer.C
 		}()
 
-		nghbrNum := len(pn.Neighbours)
+		nbrs := pn.neighbours()
+		nghbrNum := len(nbrs)
 		c := make(chan Message, nghbrNum)
 		errQueue := make(chan error, nghbrNum)
 		var wg sync.WaitGroup
+		var counting sync.Mutex
 		wg.Add(nghbrNum)
 
+		pn.traceSend(trace.PREPARE, &prepReq, nghbrNum)
 		// first send it to ourselves
-		resp := pn.Acceptor.ProcessPrepare(prepReq, pn.RoundNum)
+		resp := pn.receiveRequest(prepReq)
 		if resp.Equals(&prepReq) {
 			numAccepted++
-			singletonlogger.Debug(fmt.Sprintf("[paxosnode] I pledged and the # is %v", numAccepted))
+			pn.Tracker.Promise(checkpointOf(&prepReq))
+			pn.logAbout(&prepReq, pn.Addr, trace.PREPARE).Debugf("[paxosnode] I pledged and the # is %v", numAccepted)
+		} else {
+			pn.Metrics.PrepareNacks.Inc()
 		}
 
-		for k, v := range pn.Neighbours {
+		for k, v := range nbrs {
 
-			singletonlogger.Debug(fmt.Sprintf("[paxosnode] disseminating to neighbour %v", k))
+			pn.Logger.Debugf("[paxosnode] disseminating to neighbour %v", k)
 
 			go func(v *rpc.Client, k string) {
 				defer wg.Done()
 				var respReq Message
-				singletonlogger.Debug(fmt.Sprintf("[paxosnode] disseminating to neighbour inside %v and RPC %v", k, v))
-				errQueue <- v.Call("PaxosNodeRPCWrapper.ProcessPrepareRequest", prepReq, &respReq)
+				pn.Logger.Debugf("[paxosnode] disseminating to neighbour inside %v and RPC %v", k, v)
+				errQueue <- pn.Faults.Call(k, v, "PaxosNodeRPCWrapper.ProcessPrepareRequest", prepReq, &respReq)
 				c <- respReq
 				select {
 				case err := <-errQueue:
-					singletonlogger.Debug("[paxosnode] channel worked on PREPARE")
+					pn.Logger.Debug("[paxosnode] channel worked on PREPARE")
 					if err != nil {
-						pn.FailedNeighbours = append(pn.FailedNeighbours, k)
-						singletonlogger.Debug(fmt.Sprintf("[paxosnode] on PREPARE RPC failed %v", k))
+						pn.SuspectNeighbour(k)
+						pn.logAbout(&prepReq, k, trace.PREPARE).Debugf("[paxosnode] on PREPARE RPC failed %v", k)
 					} else {
 						req := <-c
+						pn.traceReply(k, &prepReq, &req)
+						// replies are counted one at a time, so that a step stops at each
+						counting.Lock()
 						if prepReq.Equals(&req) {
 							numAccepted++
-							singletonlogger.Debug(fmt.Sprintf("[paxosnode] on PREPARE RPC succeded %v numPledged: %v, ID: %v", req.FromProposerID, numAccepted, req.ID))
+							pn.Tracker.PromisedBy(prepReq.RoundNum, k)
+							pn.logAbout(&prepReq, k, trace.PREPARE).Debugf("[paxosnode] on PREPARE RPC succeded %v numPledged: %v, ID: %v", req.FromProposerID, numAccepted, req.ID)
+						} else {
+							pn.Metrics.PrepareNacks.Inc()
 						}
+						pn.Tracker.Reply(votesCheckpoint(&prepReq, k, numAccepted, nghbrNum))
+						counting.Unlock()
 					}
 				case <-time.After(TIMER):
-					pn.FailedNeighbours = append(pn.FailedNeighbours, k)
+					pn.SuspectNeighbour(k)
 				}
 			}(v, k)
 
 		}
 		wg.Wait()
-		if len(pn.FailedNeighbours) >= len(pn.Neighbours)/2 && len(pn.FailedNeighbours) != 0 {
-			singletonlogger.Debug(fmt.Sprintf("[paxosnode] checking failed nbrs %v", len(pn.FailedNeighbours)))
+		if failed := pn.numFailedNeighbours(); failed >= nghbrNum/2 && failed != 0 {
+			pn.Logger.Debugf("[paxosnode] checking failed nbrs %v", failed)
 			return numAccepted, nil
 		}
 
 		return numAccepted, nil
 
 	case message.ACCEPT:
-		singletonlogger.Debug("[paxosnode] ACCEPT")
-		nghbrNum := len(pn.Neighbours)
+		pn.Logger.Debug("[paxosnode] ACCEPT")
+		defer pn.Metrics.AcceptLatency.ObserveSince(time.Now())
+		nbrs := pn.neighbours()
+		nghbrNum := len(nbrs)
 		c := make(chan Message, nghbrNum)
 		errQueue := make(chan error, nghbrNum)
 		var wg sync.WaitGroup
+		var counting sync.Mutex
 		wg.Add(nghbrNum)
 
+		pn.traceSend(trace.ACCEPT, &prepReq, nghbrNum)
 		// last send it to ourselves
-		resp := pn.Acceptor.ProcessAccept(prepReq, pn.RoundNum)
+		resp := pn.receiveRequest(prepReq)
 		if resp.Equals(&prepReq) {
 			numAccepted++
-			singletonlogger.Debug(fmt.Sprintf("[paxosnode] I accepted and the # is %v", numAccepted))
+			pn.Tracker.Accept(checkpointOf(&prepReq))
+			pn.logAbout(&prepReq, pn.Addr, trace.ACCEPT).Debugf("[paxosnode] I accepted and the # is %v", numAccepted)
 			pn.SayAccepted(&prepReq)
+		} else {
+			pn.Metrics.AcceptNacks.Inc()
 		}
 
-		for k, v := range pn.Neighbours {
+		for k, v := range nbrs {
 
 			go func(k string, v *rpc.Client) {
 				defer wg.Done()
 				var respReq Message
-				singletonlogger.Debug(fmt.Sprintf("[paxosnode] disseminating ACCEPT to neighbour %v", k))
-				errQueue <- v.Call("PaxosNodeRPCWrapper.ProcessAcceptRequest", prepReq, &respReq)
+				pn.Logger.Debugf("[paxosnode] disseminating ACCEPT to neighbour %v", k)
+				errQueue <- pn.Faults.Call(k, v, "PaxosNodeRPCWrapper.ProcessAcceptRequest", prepReq, &respReq)
 				c <- respReq
 				select {
 				case err := <-errQueue:
-					singletonlogger.Debug("[paxosnode] channel worked on ACCEPT")
+					pn.Logger.Debug("[paxosnode] channel worked on ACCEPT")
 					if err != nil {
-						pn.FailedNeighbours = append(pn.FailedNeighbours, k)
-						singletonlogger.Debug(fmt.Sprintf("[paxosnode] on ACCEPT RPC failed %v", k))
+						pn.SuspectNeighbour(k)
+						pn.logAbout(&prepReq, k, trace.ACCEPT).Debugf("[paxosnode] on ACCEPT RPC failed %v", k)
 					} else {
 						req := <-c
+						pn.traceReply(k, &prepReq, &req)
+						// replies are counted one at a time, so that a step stops at each
+						counting.Lock()
 						if prepReq.Equals(&req) {
 							numAccepted++
-							singletonlogger.Debug(fmt.Sprintf("[paxosnode] on ACCEPT RPC succeded %v numAccepted: %vID: %v", req.FromProposerID, numAccepted, req.ID))
+							pn.Tracker.AcceptedBy(prepReq.RoundNum, k)
+							pn.logAbout(&prepReq, k, trace.ACCEPT).Debugf("[paxosnode] on ACCEPT RPC succeded %v numAccepted: %vID: %v", req.FromProposerID, numAccepted, req.ID)
+						} else {
+							pn.Metrics.AcceptNacks.Inc()
 						}
+						pn.Tracker.Reply(votesCheckpoint(&prepReq, k, numAccepted, nghbrNum))
+						counting.Unlock()
 					}
 				case <-time.After(TIMER):
-					pn.FailedNeighbours = append(pn.FailedNeighbours, k)
+					pn.SuspectNeighbour(k)
 				}
 			}(k, v)
 		}
 
 		wg.Wait()
 
-		if len(pn.FailedNeighbours) >= len(pn.Neighbours)/2 && len(pn.FailedNeighbours) != 0 {
-			singletonlogger.Debug(fmt.Sprintf("[paxosnode] checking failed nbrs %v", len(pn.FailedNeighbours)))
+		if failed := pn.numFailedNeighbours(); failed >= nghbrNum/2 && failed != 0 {
+			pn.Logger.Debugf("[paxosnode] checking failed nbrs %v", failed)
 			pn.RoundNum++
 			return numAccepted, nil
 		}
@@ -340,16 +467,19 @@ func (pn *PaxosNode) DisseminateRequest(prepReq Message) (numAccepted int, err e
 
 // SayAccepted sends an accept message
 func (pn *PaxosNode) SayAccepted(m *Message) {
+	nbrs := pn.neighbours()
+	notice := *m
+	notice.Sender = pn.Addr
+	pn.traceSend(trace.NOTIFY, &notice, len(nbrs))
 	// first, tell to own learner
 	pn.CountForNumAlreadyAccepted(m)
-	// then to all other nodes' learners
-
-	for k, v := range pn.Neighbours {
+	// then to all other nodes' learners, telling them who accepted
+	for k, v := range nbrs {
 		go func(k string, v *rpc.Client) {
 			var counted bool
-			e := v.Call("PaxosNodeRPCWrapper.NotifyAboutAccepted", m, &counted)
+			e := pn.Faults.Call(k, v, "PaxosNodeRPCWrapper.NotifyAboutAccepted", &notice, &counted)
 			if e != nil {
-				pn.FailedNeighbours = append(pn.FailedNeighbours, k)
+				pn.SuspectNeighbour(k)
 			}
 		}(k, v)
 
@@ -358,7 +488,12 @@ func (pn *PaxosNode) SayAccepted(m *Message) {
 
 // IsMajority helper method
 func (pn *PaxosNode) IsMajority(n int) bool {
-	if n > (len(pn.Neighbours)+1)/2 {
+	return isMajorityOf(n, len(pn.neighbours()))
+}
+
+// isMajorityOf checks if n nodes are a majority of a PN and its neighbours
+func isMajorityOf(n int, neighbours int) bool {
+	if n > (neighbours+1)/2 {
 		return true
 	}
 	return false
@@ -367,24 +502,56 @@ func (pn *PaxosNode) IsMajority(n int) bool {
 // CountForNumAlreadyAccepted takes role of Learner, adds Accepted message to the map of accepted messages,
 // and notifies learner when the # for this particular message is a majority to write into the log
 func (pn *PaxosNode) CountForNumAlreadyAccepted(m *Message) {
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] in CountForNumAlreadyAccepted, round # %v", pn.RoundNum))
+	clock := pn.Trace.Witness(m.Clock)
+	round := pn.RoundNum
+	neighbours := len(pn.neighbours())
+	learned := pn.countAccepted(m, neighbours)
+	pn.Trace.Record(trace.Event{Clock: clock, Direction: trace.RECEIVE, Kind: trace.NOTIFY, Peer: pn.senderOf(m), Round: round, Neighbours: neighbours, Message: m, Learned: learned})
+}
+
+// countAccepted counts m as accepted once more, and learns it when a majority of the PN and its neighbours has
+func (pn *PaxosNode) countAccepted(m *Message, neighbours int) (learned bool) {
+	pn.Logger.Debugf("[paxosnode] in CountForNumAlreadyAccepted, round # %v", pn.RoundNum)
+	pn.counting.Lock()
+	defer pn.counting.Unlock()
 	numSeen := pn.Learner.NumAlreadyAccepted(m)
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] in CountForNumAlreadyAccepted, how many accepted %v", numSeen))
-	if pn.IsMajority(numSeen) {
+	pn.logAbout(m, pn.senderOf(m), trace.NOTIFY).Debugf("[paxosnode] in CountForNumAlreadyAccepted, how many accepted %v", numSeen)
+	pn.Tracker.Notify(votesCheckpoint(m, pn.senderOf(m), numSeen, neighbours))
+	if isMajorityOf(numSeen, neighbours) {
+		logLen := len(pn.Learner.Log)
 		pn.RoundNum, _ = pn.Learner.LearnValue(m)
-		singletonlogger.Debug(fmt.Sprintf("[paxosnode] in CountForNumAlreadyAccepted, value learned, next round # %v", pn.RoundNum))
+		pn.Metrics.LogLength.Set(float64(len(pn.Learner.Log)))
+		if len(pn.Learner.Log) > logLen {
+			pn.VClock.LocalEvent(fmt.Sprintf("learned '%s' in round %d", m.Value, m.RoundNum))
+		}
+		pn.logAbout(m, pn.senderOf(m), trace.NOTIFY).Debugf("[paxosnode] in CountForNumAlreadyAccepted, value learned, next round # %v", pn.RoundNum)
+		return true
 	}
+	return false
+}
 
+// logAbout starts a log entry about this PN handling m with peer, in the phase of paxos m is part of
+func (pn *PaxosNode) logAbout(m *Message, peer string, phase trace.Kind) *logger.Entry {
+	return pn.Logger.With(logger.Fields{logger.NODE: pn.Addr, logger.ROUND: m.RoundNum, logger.MSGID: m.ID, logger.PEER: peer, logger.PHASE: string(phase)})
+}
+
+// senderOf is the PN whose acceptor sent the accepted notice m
+func (pn *PaxosNode) senderOf(m *Message) string {
+	if m.Sender == "" {
+		return pn.Addr
+	}
+	return m.Sender
 }
 
 // ShouldRetry checks if the round should be retried due to a lack of majority
 func (pn *PaxosNode) ShouldRetry(numAccepted int, value string, m *Message) (b bool, err error) {
 	if !pn.IsMajority(numAccepted) {
-		singletonlogger.Debug("[paxosnode] We're retrying")
+		pn.Logger.Debug("[paxosnode] We're retrying")
+		pn.Metrics.ProposalsRetried.Inc()
 		m.Bounces--
 		if m.Bounces == 0 {
 			randOffset := time.Duration(rand.Intn(RANDOFFSET))
-			singletonlogger.Debug(fmt.Sprintf("[paxosnode] sleeping for %v", randOffset))
+			pn.Logger.Debugf("[paxosnode] sleeping for %v", randOffset)
 			time.Sleep(randOffset * time.Second)
 			m.Bounces = TTL
 		}
@@ -399,86 +566,133 @@ func (pn *PaxosNode) ShouldRetry(numAccepted int, value string, m *Message) (b b
 
 // ClearFailedNeighbours removes failed neighbors from a pn's collection
 func (pn *PaxosNode) ClearFailedNeighbours() {
-	for _, ip := range pn.FailedNeighbours {
+	pn.failedLock.Lock()
+	failed := pn.FailedNeighbours
+	pn.FailedNeighbours = nil
+	pn.failedLock.Unlock()
+	for _, ip := range failed {
 		pn.RemoveFailedNeighbour(ip)
 	}
-	pn.FailedNeighbours = nil
 	pn.RoundNum++
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] cleaned nbrs, new round is # %v", pn.RoundNum))
+	pn.Logger.Debugf("[paxosnode] cleaned nbrs, new round is # %v", pn.RoundNum)
 }
 
-// RemoveFailedNeighbour removes a single neighbour
+// RemoveFailedNeighbour takes a single neighbour out of the Paxos rounds.
+// The connection manager keeps redialing it, and it rejoins once it answers again, unless it is given up on first.
 func (pn *PaxosNode) RemoveFailedNeighbour(ip string) {
-	delete(pn.Neighbours, ip)
-	pn.RemoveNbrAddr(ip)
+	pn.Conns.Disconnect(ip, "failed neighbour")
+	pn.Detector.Remove(ip)
+	pn.Metrics.Evictions.Inc()
 }
 
-// RemoveNbrAddr removes a Neighbour's addreess
-func (pn *PaxosNode) RemoveNbrAddr(ip string) {
-	for i, v := range pn.NbrAddrs {
-		if v == ip {
-			pn.NbrAddrs = append(pn.NbrAddrs[:i], pn.NbrAddrs[i+1:]...)
-			break
-		}
+// ClusterRounds collects the rounds recorded by the tracker of this PN and of every neighbour, keyed by PN address.
+// Neighbours that fail to answer are listed in unreachable.
+func (pn *PaxosNode) ClusterRounds() (reports map[string][]paxostracker.PaxosRound, unreachable []string) {
+	reports = map[string][]paxostracker.PaxosRound{pn.Addr: pn.Tracker.Rounds()}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for k, v := range pn.neighbours() {
+		wg.Add(1)
+		go func(k string, v *rpc.Client) {
+			defer wg.Done()
+			var rounds []paxostracker.PaxosRound
+			call := v.Go("PaxosNodeRPCWrapper.GetRounds", "placeholder", &rounds, nil)
+			var err error
+			select {
+			case <-call.Done:
+				err = call.Error
+			case <-time.After(TIMER):
+				err = fmt.Errorf("timed out")
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				pn.Logger.Debugf("[paxosnode] unable to get rounds from %v: %v", k, err)
+				unreachable = append(unreachable, k)
+				return
+			}
+			reports[k] = rounds
+		}(k, v)
 	}
+	wg.Wait()
+	sort.Strings(unreachable)
+	return reports, unreachable
+}
+
+// checkpointOf describes m to the tracker's breakpoints
+func checkpointOf(m *Message) breakpoint.Context {
+	return breakpoint.Context{Round: m.RoundNum, ID: m.ID, Value: m.Value, Peer: m.FromProposerID}
+}
+
+// votesCheckpoint is where a vote from peer on m was counted, votes of the PN and its neighbours being in favour so far
+func votesCheckpoint(m *Message, peer string, votes int, neighbours int) breakpoint.Context {
+	return breakpoint.Context{Round: m.RoundNum, ID: m.ID, Value: m.Value, Peer: peer, Votes: votes, Of: neighbours + 1}
+}
+
+// NeighbourStatus reports the connection state of every neighbour, connected or being redialed
+func (pn *PaxosNode) NeighbourStatus() []connmanager.PeerStatus {
+	return pn.Conns.Status()
 }
 
 // NotifyOfMajorityFailure helper
 func (pn *PaxosNode) NotifyOfMajorityFailure() {
-	nghbrNum := len(pn.Neighbours)
+	nbrs := pn.neighbours()
+	nghbrNum := len(nbrs)
 	var wg sync.WaitGroup
 	wg.Add(nghbrNum)
 	var b bool
 	c := make(chan bool, nghbrNum)
 	errQueue := make(chan error, nghbrNum)
+	pn.traceSend(trace.CLEAN, nil, nghbrNum)
 
-	for k, v := range pn.Neighbours {
+	for k, v := range nbrs {
 		go func(k string, v *rpc.Client) {
 			defer wg.Done()
-			errQueue <- v.Call("PaxosNodeRPCWrapper.CleanYourNeighbours", k, &b)
+			errQueue <- pn.Faults.Call(k, v, "PaxosNodeRPCWrapper.CleanYourNeighbours", k, &b)
 			c <- b
 
 			select {
 			case err := <-errQueue:
-				singletonlogger.Debug("[paxosnode] channel worked on MAJOR FAILURE")
+				pn.Logger.Debug("[paxosnode] channel worked on MAJOR FAILURE")
 				if err != nil {
-					pn.FailedNeighbours = append(pn.FailedNeighbours, k)
-					singletonlogger.Debug(fmt.Sprintf("[paxosnode] on MAJOR FAILURE RPC failed %v", k))
+					pn.SuspectNeighbour(k)
+					pn.Logger.Debugf("[paxosnode] on MAJOR FAILURE RPC failed %v", k)
 				}
 			case <-time.After(TIMER):
-				pn.FailedNeighbours = append(pn.FailedNeighbours, k)
+				pn.SuspectNeighbour(k)
 			}
 		}(k, v)
 	}
 	wg.Wait()
-	singletonlogger.Debug(fmt.Sprintf("[paxosnode] notified nbrs, new round is # %v", pn.RoundNum))
+	pn.Logger.Debugf("[paxosnode] notified nbrs, new round is # %v", pn.RoundNum)
 }
 
 // CleanNbrsOnRequest to remove neighbours when requested
 func (pn *PaxosNode) CleanNbrsOnRequest(neighbour string) (b bool) {
-	nghbrNum := len(pn.Neighbours) - 1
+	nbrs := pn.neighbours()
+	nghbrNum := len(nbrs)
 	var wg sync.WaitGroup
-	wg.Add(nghbrNum)
 	c := make(chan bool, nghbrNum)
 	errQueue := make(chan error, nghbrNum)
 
-	for k, v := range pn.Neighbours {
+	for k, v := range nbrs {
 		if k == neighbour {
 			continue
 		}
+		wg.Add(1)
 		go func(k string, v *rpc.Client) {
 			defer wg.Done()
-			errQueue <- v.Call("PaxosNodeRPCWrapper.RUAlive", k, &b)
+			errQueue <- pn.Faults.Call(k, v, "PaxosNodeRPCWrapper.RUAlive", k, &b)
 			c <- b
 			select {
 			case err := <-errQueue:
-				singletonlogger.Debug("[paxosnode] channel worked on CLEANING")
+				pn.Logger.Debug("[paxosnode] channel worked on CLEANING")
 				if err != nil {
-					pn.FailedNeighbours = append(pn.FailedNeighbours, k)
-					singletonlogger.Debug(fmt.Sprintf("[paxosnode] on CLEANING failed %v", k))
+					pn.SuspectNeighbour(k)
+					pn.Logger.Debugf("[paxosnode] on CLEANING failed %v", k)
 				}
 			case <-time.After(TIMER):
-				pn.FailedNeighbours = append(pn.FailedNeighbours, k)
+				pn.SuspectNeighbour(k)
 			}
 		}(k, v)
 	}
@@ -486,3 +700,90 @@ func (pn *PaxosNode) CleanNbrsOnRequest(neighbour string) (b bool) {
 	pn.ClearFailedNeighbours()
 	return true
 }
+
+// SuspectNeighbour is called when an RPC to a neighbour fails or times out. A single failure is not enough:
+// the neighbour is only marked as failed once the failure detector's suspicion reaches PHITHRESHOLD.
+func (pn *PaxosNode) SuspectNeighbour(ip string) {
+	phi := pn.Detector.Phi(ip)
+	if phi < PHITHRESHOLD {
+		pn.Logger.Debugf("[paxosnode] RPC to %v failed, but phi is only %.2f", ip, phi)
+		return
+	}
+	pn.failedLock.Lock()
+	defer pn.failedLock.Unlock()
+	for _, failed := range pn.FailedNeighbours {
+		if failed == ip {
+			return
+		}
+	}
+	pn.Logger.Debugf("[paxosnode] marking %v as failed, phi is %.2f", ip, phi)
+	pn.FailedNeighbours = append(pn.FailedNeighbours, ip)
+}
+
+// PingNeighbours feeds the failure detector, and evicts neighbours whose suspicion passes PHITHRESHOLD
+func (pn *PaxosNode) PingNeighbours() {
+	ticker := time.NewTicker(PINGINTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pn.stopPinging:
+			return
+		case <-ticker.C:
+		}
+		for k, v := range pn.neighbours() {
+			if pn.Detector.Suspect(k) {
+				pn.Logger.Debugf("[paxosnode] evicting %v, phi is %.2f", k, pn.Detector.Phi(k))
+				pn.RemoveFailedNeighbour(k)
+				continue
+			}
+			go func(k string, v *rpc.Client) {
+				var alive bool
+				call := pn.Faults.Go(k, v, "PaxosNodeRPCWrapper.Ping", pn.Addr, &alive, nil)
+				select {
+				case <-call.Done:
+					// a reply racing the neighbour's eviction must not bring back its detector state
+					if call.Error == nil && pn.Conns.IsConnected(k) {
+						pn.Detector.Heartbeat(k)
+					}
+				case <-time.After(TIMER):
+				}
+			}(k, v)
+		}
+	}
+}
+
+// neighbours returns a snapshot of the connected neighbours; calls are only ever sent to these
+func (pn *PaxosNode) neighbours() map[string]*rpc.Client {
+	return pn.Conns.Connected()
+}
+
+// dial opens a new RPC connection to another PN, over mutual TLS when configured
+func (pn *PaxosNode) dial(addr string) (*rpc.Client, error) {
+	return pn.sec.DialRPC(addr, pn.VClock)
+}
+
+// introduce asks the PN at the other end of conn to open its own connection back to us,
+// and starts its failure detector history once it has
+func (pn *PaxosNode) introduce(addr string, conn *rpc.Client) error {
+	var challenge string
+	err := pn.Faults.Call(addr, conn, "PaxosNodeRPCWrapper.JoinChallenge", pn.Addr, &challenge)
+	if err != nil {
+		return fmt.Errorf("unable to get a join challenge from %s: %s", addr, err)
+	}
+	connected := false
+	err = pn.Faults.Call(addr, conn, "PaxosNodeRPCWrapper.ConnectRemoteNeighbour", pn.sec.NewJoinRequest(pn.Addr, challenge), &connected)
+	if err != nil {
+		return fmt.Errorf("unable to connect remote neighbour %s: %s", addr, err)
+	}
+	if !connected {
+		return fmt.Errorf("remote neighbour %s refused the connection", addr)
+	}
+	pn.Detector.Heartbeat(addr)
+	return nil
+}
+
+func (pn *PaxosNode) numFailedNeighbours() int {
+	pn.failedLock.Lock()
+	defer pn.failedLock.Unlock()
+	return len(pn.FailedNeighbours)
+}
@@ -16,6 +16,14 @@ type PaxosNodeInterface interface {
 	// Gets the entire log on the Paxos Network
 	GetLog() (log []Message, err error)
 
+	// Gets the values learned in slots from up to, but not including, to
+	// Can return the following errors:
+	// - InvalidLogRangeError when from is negative or above to
+	GetLogRange(from, to int) (log []Message, err error)
+
+	// Gets the number of values learned
+	GetLogLength() int
+
 	// Handles the entire process of proposing a value and trying to achieve consensus.
 	// ttl represents the # of times it will retry a write before it goes to sleep.
 	// It will either try forever or fail.
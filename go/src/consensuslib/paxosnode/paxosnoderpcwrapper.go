@@ -4,15 +4,29 @@
 package paxosnode
 
 import (
+	"consensuslib/errors"
 	"consensuslib/message"
-	"filelogger/singletonlogger"
+	"consensuslib/paxosnode/trace"
+	"consensuslib/security"
+	"crypto/x509"
+	"filelogger/vclock"
 	"fmt"
+	"net"
+	"net/rpc"
+	"paxostracker"
 )
 
 type Message = message.Message
 
+// LogRange of slots, from up to, but not including, To
+type LogRange struct {
+	From int
+	To   int
+}
+
 type PaxosNodeRPCWrapper struct {
 	paxosNode *PaxosNode
+	peer      *x509.Certificate // certificate of the PN on the other end, nil without TLS
 }
 
 func NewPaxosNodeRPCWrapper(paxosNode *PaxosNode) (wrapper *PaxosNodeRPCWrapper, err error) {
@@ -22,37 +36,80 @@ func NewPaxosNodeRPCWrapper(paxosNode *PaxosNode) (wrapper *PaxosNodeRPCWrapper,
 	return wrapper, nil
 }
 
+// Serve RPCs from other PNs on listener, and from debug clients too when the PN has DebugControl on.
+// Every connection gets its own RPC server and wrapper, so with TLS the handlers know which certificate the caller
+// presented.
+func Serve(listener net.Listener, wrapper *PaxosNodeRPCWrapper) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("[paxosnodewrapper] unable to accept connection: %s", err)
+		}
+		go func(conn net.Conn) {
+			cert, err := security.PeerCertificate(conn)
+			if err != nil {
+				wrapper.paxosNode.Logger.Warnf("[paxosnodewrapper] rejecting connection: %s", err)
+				conn.Close()
+				return
+			}
+			server := rpc.NewServer()
+			server.Register(&PaxosNodeRPCWrapper{paxosNode: wrapper.paxosNode, peer: cert})
+			if wrapper.paxosNode.DebugControl {
+				server.Register(&DebugControl{paxosNode: wrapper.paxosNode})
+			}
+			vclock.ServeConn(server, conn, wrapper.paxosNode.VClock)
+		}(conn)
+	}
+}
+
 // RPC to a PN's acceptor to process a new Prepare Request
 func (p *PaxosNodeRPCWrapper) ProcessPrepareRequest(m Message, r *Message) (err error) {
-	singletonlogger.Debug("[paxosnodewrapper] increasing message ID")
+	p.paxosNode.logAbout(&m, m.FromProposerID, trace.PREPARE).Debug("[paxosnodewrapper] increasing message ID")
 	p.paxosNode.Proposer.IncrementMessageID()
-	*r = p.paxosNode.Acceptor.ProcessPrepare(m, p.paxosNode.RoundNum)
+	*r = p.paxosNode.receiveRequest(m)
+	if m.Equals(r) {
+		p.paxosNode.Tracker.Promise(checkpointOf(&m))
+	}
 	return nil
 }
 
 // RPC to a PN's acceptor to process a new Accept Request
 // If the request accepted, it gets disseminated to all the Learners in the Paxos NW
 func (p *PaxosNodeRPCWrapper) ProcessAcceptRequest(m Message, r *Message) (err error) {
-	singletonlogger.Debug("[paxosnodewrapper] RPC processing accept request")
-	*r = p.paxosNode.Acceptor.ProcessAccept(m, p.paxosNode.RoundNum)
+	p.paxosNode.logAbout(&m, m.FromProposerID, trace.ACCEPT).Debug("[paxosnodewrapper] RPC processing accept request")
+	*r = p.paxosNode.receiveRequest(m)
 	if m.Equals(r) {
-		singletonlogger.Debug("[paxosnodewrapper] saying accepted")
+		p.paxosNode.Tracker.Accept(checkpointOf(&m))
+		p.paxosNode.logAbout(&m, m.FromProposerID, trace.ACCEPT).Debug("[paxosnodewrapper] saying accepted")
 		go p.paxosNode.SayAccepted(r)
 	}
 	return nil
 }
 
+// RPC which hands a node that wants to connect a single-use challenge, to be answered with the join token
+func (p *PaxosNodeRPCWrapper) JoinChallenge(addr string, challenge *string) (err error) {
+	*challenge, err = p.paxosNode.challenges.Issue()
+	return err
+}
+
 // RPC which is called by another node that tries to connect to the current one
-func (p *PaxosNodeRPCWrapper) ConnectRemoteNeighbour(addr string, r *bool) (err error) {
-	singletonlogger.Debug("[paxoswrapper] connecting my remote neighbour")
-	err = p.paxosNode.AcceptNeighbourConnection(addr, r)
-	//singletonlogger.Debug("[paxoswrapper] error on connection? ", *r)
+func (p *PaxosNodeRPCWrapper) ConnectRemoteNeighbour(req security.JoinRequest, r *bool) (err error) {
+	p.paxosNode.Logger.Debug("[paxoswrapper] connecting my remote neighbour")
+	if err = security.VerifyPeerAddr(p.peer, req.Addr); err != nil {
+		p.paxosNode.Logger.Warnf("[paxoswrapper] refusing neighbour %s: %s", req.Addr, err)
+		return errors.PeerIdentityError(err.Error())
+	}
+	err = p.paxosNode.AcceptNeighbourConnection(req, r)
+	//p.paxosNode.Logger.Debug("[paxoswrapper] error on connection? ", *r)
 	return err
 }
 
 // RPC to the Learner from other node's Acceptor about value it accepted
 func (p *PaxosNodeRPCWrapper) NotifyAboutAccepted(m *Message, r *bool) (err error) {
-	singletonlogger.Debug(fmt.Sprintf("[paxosnodewrapper] notify about accepted %v", m.Type))
+	p.paxosNode.Logger.Debugf("[paxosnodewrapper] notify about accepted %v", m.Type)
+	if m.Sender != "" {
+		p.paxosNode.Tracker.AcceptedBy(m.RoundNum, m.Sender)
+	}
 	p.paxosNode.CountForNumAlreadyAccepted(m)
 	return err
 }
@@ -64,10 +121,17 @@ func (p *PaxosNodeRPCWrapper) ReadFromLearner(placeholder string, log *[]Message
 	return nil
 }
 
+// RPC that reads a range of the log from a PN's learner, so a long log need not be sent whole
+func (p *PaxosNodeRPCWrapper) ReadRangeFromLearner(r LogRange, log *[]Message) (err error) {
+	*log, err = p.paxosNode.GetLogRange(r.From, r.To)
+	return err
+}
+
 // RPC to notify a PN that majority failed and needs to be recalibrated
 // makes a call to a node to clean failed neighbours
 func (p *PaxosNodeRPCWrapper) CleanYourNeighbours(neighbour string, b *bool) (err error) {
-	singletonlogger.Debug(fmt.Sprintf("[paxosnodewrapper] cleaning request from %s", neighbour))
+	p.paxosNode.Logger.Debugf("[paxosnodewrapper] cleaning request from %s", neighbour)
+	p.paxosNode.Trace.Record(trace.Event{Clock: p.paxosNode.Trace.Tick(), Direction: trace.RECEIVE, Kind: trace.CLEAN, Round: p.paxosNode.RoundNum})
 	*b = p.paxosNode.CleanNbrsOnRequest(neighbour)
 	return nil
 }
@@ -77,3 +141,20 @@ func (p *PaxosNodeRPCWrapper) RUAlive(placeholder string, b *bool) (err error) {
 	*b = true
 	return nil
 }
+
+// RPC that returns the rounds recorded by this PN's tracker, for the cluster-wide timeline
+func (p *PaxosNodeRPCWrapper) GetRounds(placeholder string, rounds *[]paxostracker.PaxosRound) (err error) {
+	*rounds = p.paxosNode.Tracker.Rounds()
+	return nil
+}
+
+// RPC pinged periodically by every neighbour to feed their failure detectors.
+// Pings are heartbeats both ways, so the caller is recorded as heard from too, if it is a neighbour: anyone else,
+// e.g. a neighbour evicted since, is answered without being tracked.
+func (p *PaxosNodeRPCWrapper) Ping(from string, b *bool) (err error) {
+	if p.paxosNode.Conns.IsConnected(from) {
+		p.paxosNode.Detector.Heartbeat(from)
+	}
+	*b = true
+	return nil
+}
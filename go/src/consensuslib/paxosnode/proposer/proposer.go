@@ -2,17 +2,19 @@ package proposer
 
 import (
 	"consensuslib/message"
-	"filelogger/singletonlogger"
-	"fmt"
+	"consensuslib/paxosnode/backup"
+	"filelogger/logger"
 )
 
 type Message = message.Message
 
 type ProposerRole struct {
 	proposerID            string
+	proposals             *backup.Journal // of the accept requests created
 	messageID             uint64
 	CurrentPrepareRequest Message
 	CurrentAcceptRequest  Message
+	logger                *logger.Logger
 }
 
 type ProposerInterface interface {
@@ -43,7 +45,7 @@ type ProposerInterface interface {
 func (proposer *ProposerRole) CreatePrepareRequest(roundNum int, msgHash string, ttl int) Message {
 	// Increment the messageID (n value) every time a new prepare request is made
 	proposer.messageID++
-	singletonlogger.Debug(fmt.Sprintf("[Proposer] message ID at proposer %v", proposer.messageID))
+	proposer.logger.Debugf("[Proposer] message ID at proposer %v", proposer.messageID)
 	/*prepareRequest := Message{
 		ID:             proposer.messageID,
 		Type:           message.PREPARE,
@@ -64,6 +66,10 @@ func (proposer *ProposerRole) CreateAcceptRequest(value, msgHash string, roundNu
 		RoundNum:		roundNum,
 	}*/
 	acceptRequest := message.NewMessage(proposer.messageID, msgHash, message.ACCEPT, value, proposer.proposerID, roundNum, ttl)
+	// every value proposed is kept, so that an offline check can tell that each learned value was proposed
+	if err := proposer.proposals.Append(acceptRequest); err != nil {
+		proposer.logger.Debugf("[Proposer] errored on saving accept request %v", err)
+	}
 	return acceptRequest
 }
 
@@ -72,19 +78,26 @@ func (proposer *ProposerRole) UpdateMessageID(messageID uint64) {
 }
 
 func (proposer *ProposerRole) IncrementMessageID() {
-	singletonlogger.Debug(fmt.Sprintf("[Proposer] increasing message ID before %v", proposer.messageID))
+	proposer.logger.Debugf("[Proposer] increasing message ID before %v", proposer.messageID)
 	proposer.messageID++
-	singletonlogger.Debug(fmt.Sprintf("[Proposer] increasing message ID after %v", proposer.messageID))
+	proposer.logger.Debugf("[Proposer] increasing message ID after %v", proposer.messageID)
 }
 
 // The constructor for a new ProposerRole object instance. A PN should only interact with just one
-// ProposerRole instance at a time
-func NewProposer(proposerID string) ProposerRole {
+// ProposerRole instance at a time. The accept requests it creates are saved to a file named after backupID.
+func NewProposer(proposerID string, backupID string, log *logger.Logger) ProposerRole {
 	proposer := ProposerRole{
 		proposerID:            proposerID,
+		proposals:             backup.NewJournal(backup.Path(backupID, backup.PROPOSALS)),
 		messageID:             0,
 		CurrentPrepareRequest: Message{},
 		CurrentAcceptRequest:  Message{},
+		logger:                log,
 	}
 	return proposer
 }
+
+// Close the file of accept requests, e.g. when the PN is unmounted
+func (proposer *ProposerRole) Close() error {
+	return proposer.proposals.Close()
+}
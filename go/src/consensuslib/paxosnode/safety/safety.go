@@ -0,0 +1,219 @@
+package safety
+
+import (
+	"consensuslib/message"
+	"consensuslib/paxosnode/acceptor"
+	"consensuslib/paxosnode/backup"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ * Offline checks of the Paxos safety properties, over the files PNs keep on disk (see package backup):
+ *   AGREEMENT   no slot has two different learned values
+ *   PROMISE     no acceptor accepted a ballot lower than one it promised for the same slot
+ *   VALIDITY    every learned value was proposed by some client
+ * The files of every PN of a run have to be gathered in one directory, and that directory emptied before the run,
+ * as acceptor histories are appended to across runs.
+ */
+
+type Message = message.Message
+
+// AGREEMENT is violated when two learners learned different values for a slot
+const AGREEMENT = "agreement"
+
+// PROMISE is violated when an acceptor accepted a ballot lower than one it promised
+const PROMISE = "promise"
+
+// VALIDITY is violated when a learned value was never proposed
+const VALIDITY = "validity"
+
+// Node is what one PN left on disk, any of which may be missing
+type Node struct {
+	ID        string // the port of the PN, prefixing its files
+	Learned   []Message
+	History   []acceptor.Decision
+	Proposals []Message
+}
+
+// Violation of a property at a slot, by the nodes involved
+type Violation struct {
+	Property string
+	Slot     int
+	Nodes    []string
+	Detail   string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s violated at slot %d by %s: %s", v.Property, v.Slot, strings.Join(v.Nodes, ", "), v.Detail)
+}
+
+// Load reads the files of every PN in dir
+func Load(dir string) (nodes []*Node, err error) {
+	byID := make(map[string]*Node)
+	node := func(path string, name string) *Node {
+		id := strings.TrimSuffix(filepath.Base(path), name)
+		if byID[id] == nil {
+			byID[id] = &Node{ID: id}
+		}
+		return byID[id]
+	}
+	learned, err := filepath.Glob(filepath.Join(dir, "*"+backup.LEARNED))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range learned {
+		n := node(path, backup.LEARNED)
+		err = backup.ReadJSONLines(path, func(line []byte) error {
+			var m Message
+			err := json.Unmarshal(line, &m)
+			n.Learned = append(n.Learned, m)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	histories, err := filepath.Glob(filepath.Join(dir, "*"+backup.HISTORY))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range histories {
+		n := node(path, backup.HISTORY)
+		err = backup.ReadJSONLines(path, func(line []byte) error {
+			var d acceptor.Decision
+			err := json.Unmarshal(line, &d)
+			n.History = append(n.History, d)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	proposals, err := filepath.Glob(filepath.Join(dir, "*"+backup.PROPOSALS))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range proposals {
+		n := node(path, backup.PROPOSALS)
+		err = backup.ReadJSONLines(path, func(line []byte) error {
+			var m Message
+			err := json.Unmarshal(line, &m)
+			n.Proposals = append(n.Proposals, m)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(byID) == 0 {
+		return nil, fmt.Errorf("no learner logs, acceptor histories or proposals in %s", dir)
+	}
+	for _, n := range byID {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes, nil
+}
+
+// Check every property over nodes, returning the violations ordered by property then slot
+func Check(nodes []*Node) (violations []Violation) {
+	violations = append(violations, CheckAgreement(nodes)...)
+	violations = append(violations, CheckPromises(nodes)...)
+	violations = append(violations, CheckValidity(nodes)...)
+	return violations
+}
+
+// CheckAgreement reports every slot learned with different values
+func CheckAgreement(nodes []*Node) (violations []Violation) {
+	type value struct {
+		hash  string
+		value string
+	}
+	for slot := 0; ; slot++ {
+		learners := make(map[value][]string) // each value learned to the nodes that learned it
+		var values []value
+		for _, n := range nodes {
+			if slot >= len(n.Learned) {
+				continue
+			}
+			v := value{n.Learned[slot].MsgHash, n.Learned[slot].Value}
+			if _, ok := learners[v]; !ok {
+				values = append(values, v)
+			}
+			learners[v] = append(learners[v], n.ID)
+		}
+		if len(values) == 0 {
+			return violations
+		}
+		if len(values) == 1 {
+			continue
+		}
+		var involved, learnt []string
+		for _, v := range values {
+			involved = append(involved, learners[v]...)
+			learnt = append(learnt, fmt.Sprintf("%s learned '%s'", strings.Join(learners[v], ", "), v.value))
+		}
+		violations = append(violations, Violation{AGREEMENT, slot, involved, strings.Join(learnt, "; ")})
+	}
+}
+
+// CheckPromises reports every accept of a ballot lower than one promised before for the same slot
+func CheckPromises(nodes []*Node) (violations []Violation) {
+	for _, n := range nodes {
+		promised := make(map[int]Message) // highest ballot promised for each slot
+		for _, d := range n.History {
+			slot := d.Request.RoundNum
+			highest, ok := promised[slot]
+			switch {
+			case d.Promised && (!ok || d.Request.ID > highest.ID):
+				promised[slot] = d.Request
+			case d.Accepted && ok && d.Request.ID < highest.ID:
+				detail := fmt.Sprintf("accepted ballot %d of %s for '%s' after promising ballot %d to %s",
+					d.Request.ID, d.Request.FromProposerID, d.Request.Value, highest.ID, highest.FromProposerID)
+				violations = append(violations, Violation{PROMISE, slot, []string{n.ID}, detail})
+			}
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Slot < violations[j].Slot })
+	return violations
+}
+
+// CheckValidity reports every learned value no proposer asked to be accepted
+func CheckValidity(nodes []*Node) (violations []Violation) {
+	proposed := make(map[string]string) // hash of each value proposed to the value
+	for _, n := range nodes {
+		for _, m := range n.Proposals {
+			proposed[m.MsgHash] = m.Value
+		}
+	}
+	type learnt struct {
+		slot int
+		hash string
+	}
+	var order []learnt
+	learners := make(map[learnt][]string)
+	values := make(map[learnt]string)
+	for _, n := range nodes {
+		for slot, m := range n.Learned {
+			if value, ok := proposed[m.MsgHash]; ok && value == m.Value {
+				continue
+			}
+			l := learnt{slot, m.MsgHash}
+			if _, ok := learners[l]; !ok {
+				order = append(order, l)
+				values[l] = m.Value
+			}
+			learners[l] = append(learners[l], n.ID)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].slot < order[j].slot })
+	for _, l := range order {
+		detail := fmt.Sprintf("learned '%s', which was never proposed", values[l])
+		violations = append(violations, Violation{VALIDITY, l.slot, learners[l], detail})
+	}
+	return violations
+}
@@ -0,0 +1,143 @@
+package trace
+
+import (
+	"bufio"
+	"consensuslib/message"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+/**
+ * Trace records every protocol message a PN sends or receives as one JSON event per line, so a run can be
+ * inspected after the fact and replayed into a fresh PN (see paxosnode.Replay).
+ *
+ * Events are stamped with a Lamport clock. Prepare, accept and notify messages carry the sender's clock in
+ * Message.Clock and acceptors stamp their replies, so a send always comes before the receives it causes.
+ * Events are written in the order they complete, which for received messages is the order they were processed in.
+ */
+
+// Kind is the protocol message an event is about
+type Kind string
+
+const (
+	// PREPARE request from a proposer to an acceptor
+	PREPARE Kind = "prepare"
+	// ACCEPT request from a proposer to an acceptor
+	ACCEPT Kind = "accept"
+	// NOTIFY notice from an acceptor to the learners about a value it accepted
+	NOTIFY Kind = "notify"
+	// CLEAN request from a proposer that failed to get a majority, for its neighbours to drop failed nodes
+	CLEAN Kind = "clean"
+	// LOG taken over from the neighbours when joining
+	LOG Kind = "log"
+	// SNAPSHOT of the acceptor and learner when the recording started, so a replay starts from the same state
+	SNAPSHOT Kind = "snapshot"
+)
+
+// Direction of the message of an event, as seen by the recording PN
+type Direction string
+
+const (
+	// SEND is a message leaving the PN, once for all of its neighbours
+	SEND Direction = "send"
+	// RECEIVE is a message processed by the PN, from a neighbour or from itself
+	RECEIVE Direction = "receive"
+	// REPLY is a neighbour's answer to a message the PN sent
+	REPLY Direction = "reply"
+	// LOCAL is a change of state not caused by a message
+	LOCAL Direction = "local"
+)
+
+// Event is one line of a trace
+type Event struct {
+	Clock      int    // Lamport clock of the recording PN
+	Node       string // the recording PN
+	Direction  Direction
+	Kind       Kind
+	Peer       string            `json:",omitempty"` // the other PN, empty for a send to every neighbour
+	Round      int               // round the PN was in when the event happened
+	Neighbours int               // neighbours the PN had, which decides what a majority is
+	Message    *message.Message  `json:",omitempty"` // message sent or received
+	Reply      *message.Message  `json:",omitempty"` // acceptor's answer to a prepare or accept
+	Learned    bool              `json:",omitempty"` // whether a notify made the PN learn its value
+	Log        []message.Message `json:",omitempty"` // learner's log, for LOG and SNAPSHOT
+	Promised   *message.Message  `json:",omitempty"` // acceptor's last promise, for SNAPSHOT
+	Accepted   *message.Message  `json:",omitempty"` // acceptor's last accept, for SNAPSHOT
+}
+
+// Recorder writes the events of one PN. A nil Recorder records nothing, so PNs can call it unconditionally.
+type Recorder struct {
+	sync.Mutex
+	node    string
+	clock   int
+	out     io.WriteCloser
+	encoder *json.Encoder
+}
+
+// NewRecorder records the events of the PN at node to out
+func NewRecorder(node string, out io.WriteCloser) *Recorder {
+	return &Recorder{node: node, out: out, encoder: json.NewEncoder(out)}
+}
+
+// Tick advances the clock for an event of this PN, returning its timestamp
+func (r *Recorder) Tick() int {
+	if r == nil {
+		return 0
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.clock++
+	return r.clock
+}
+
+// Witness advances the clock past a timestamp received from another PN, returning the receive's timestamp
+func (r *Recorder) Witness(clock int) int {
+	if r == nil {
+		return 0
+	}
+	r.Lock()
+	defer r.Unlock()
+	if clock > r.clock {
+		r.clock = clock
+	}
+	r.clock++
+	return r.clock
+}
+
+// Record e, stamped with the clock it was given by Tick or Witness
+func (r *Recorder) Record(e Event) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	e.Node = r.node
+	// a trace that cannot be written is not worth failing the PN for
+	r.encoder.Encode(e)
+}
+
+// Close the trace
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	return r.out.Close()
+}
+
+// Read every event of a trace, in the order they were recorded
+func Read(in io.Reader) (events []Event, err error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e Event
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return events, fmt.Errorf("bad event on line %d: %s", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,147 @@
+// this class records the protocol messages of a PN to its trace,
+// and replays a recorded trace into a fresh PN to check that it makes the same decisions
+
+package paxosnode
+
+import (
+	"consensuslib/message"
+	"consensuslib/paxosnode/trace"
+	"filelogger/logger"
+	"fmt"
+	"io"
+)
+
+// StartTrace records every protocol message of the PN to out, starting with a snapshot of its acceptor and learner.
+// It must be called before the PN takes part in any round.
+func (pn *PaxosNode) StartTrace(out io.WriteCloser) {
+	pn.Trace = trace.NewRecorder(pn.Addr, out)
+	promised := pn.Acceptor.LastPromised
+	accepted := pn.Acceptor.LastAccepted
+	log, _ := pn.GetLog()
+	pn.Trace.Record(trace.Event{
+		Clock:     pn.Trace.Tick(),
+		Direction: trace.LOCAL,
+		Kind:      trace.SNAPSHOT,
+		Round:     pn.RoundNum,
+		Log:       log,
+		Promised:  &promised,
+		Accepted:  &accepted,
+	})
+}
+
+// receiveRequest has the PN's acceptor answer a prepare or accept request, from a neighbour or from the PN itself
+func (pn *PaxosNode) receiveRequest(m Message) (reply Message) {
+	clock := pn.Trace.Witness(m.Clock)
+	round := pn.RoundNum
+	if m.Type == message.PREPARE {
+		reply = pn.Acceptor.ProcessPrepare(m, round)
+	} else {
+		reply = pn.Acceptor.ProcessAccept(m, round)
+	}
+	reply.Clock = clock
+	pn.Trace.Record(trace.Event{
+		Clock:      clock,
+		Direction:  trace.RECEIVE,
+		Kind:       kindOf(&m),
+		Peer:       m.FromProposerID,
+		Round:      round,
+		Neighbours: len(pn.neighbours()),
+		Message:    &m,
+		Reply:      &reply,
+	})
+	return reply
+}
+
+// traceSend stamps m with the PN's clock and records it as sent to every neighbour. m is nil for clean requests.
+func (pn *PaxosNode) traceSend(kind trace.Kind, m *Message, neighbours int) {
+	clock := pn.Trace.Tick()
+	var sent *Message
+	if m != nil {
+		m.Clock = clock
+		copied := *m
+		sent = &copied
+	}
+	pn.Trace.Record(trace.Event{Clock: clock, Direction: trace.SEND, Kind: kind, Round: pn.RoundNum, Neighbours: neighbours, Message: sent})
+}
+
+// traceReply records the answer of the acceptor at peer to the request m
+func (pn *PaxosNode) traceReply(peer string, m *Message, reply *Message) {
+	clock := pn.Trace.Witness(reply.Clock)
+	sent := *m
+	answer := *reply
+	pn.Trace.Record(trace.Event{Clock: clock, Direction: trace.REPLY, Kind: kindOf(m), Peer: peer, Round: pn.RoundNum, Message: &sent, Reply: &answer})
+}
+
+func kindOf(m *Message) trace.Kind {
+	if m.Type == message.PREPARE {
+		return trace.PREPARE
+	}
+	return trace.ACCEPT
+}
+
+// Divergence is a decision a replayed PN made differently from the PN that recorded the trace
+type Divergence struct {
+	Event    trace.Event
+	Replayed string
+}
+
+// Replay feeds the messages a PN received, as recorded in its trace, into a fresh PN with the same address,
+// and returns the decisions it made differently: acceptor replies to prepare and accept requests, and whether
+// accepted notices made it learn. The PN's own proposals and the neighbours it dropped depend on its client and
+// the network, so sends, replies and clean requests are not replayed.
+// The replayed acceptor saves its backups under temp1/ like any other, so replay away from a live node's directory.
+// The replayed PN logs to log, or nowhere when log is nil.
+func Replay(events []trace.Event, log *logger.Logger) (pn *PaxosNode, divergences []Divergence, err error) {
+	if len(events) == 0 || events[0].Kind != trace.SNAPSHOT {
+		return nil, nil, fmt.Errorf("a trace must start with a snapshot")
+	}
+	pn, err = NewPaxosNode(events[0].Node, nil, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pn.UnmountPaxosNode()
+	for _, e := range events {
+		switch {
+		case e.Kind == trace.SNAPSHOT:
+			if e.Promised != nil && e.Accepted != nil {
+				pn.Acceptor.LastPromised = *e.Promised
+				pn.Acceptor.LastAccepted = *e.Accepted
+			}
+			pn.Learner.InitializeLog(e.Log)
+		case e.Kind == trace.LOG:
+			pn.Learner.InitializeLog(e.Log)
+		case e.Direction != trace.RECEIVE:
+			// not replayed
+		case e.Kind == trace.PREPARE || e.Kind == trace.ACCEPT:
+			pn.RoundNum = e.Round
+			reply := pn.receiveRequest(*e.Message)
+			if !sameAnswer(&reply, e.Reply) {
+				divergences = append(divergences, Divergence{e, fmt.Sprintf("answered %s", describe(&reply))})
+			}
+		case e.Kind == trace.NOTIFY:
+			pn.RoundNum = e.Round
+			if learned := pn.countAccepted(e.Message, e.Neighbours); learned != e.Learned {
+				divergences = append(divergences, Divergence{e, fmt.Sprintf("learned %v", learned)})
+			}
+		}
+	}
+	return pn, divergences, nil
+}
+
+// sameAnswer checks if two acceptor replies are the same promise or accept
+func sameAnswer(m *Message, m1 *Message) bool {
+	return m.ID == m1.ID && m.MsgHash == m1.MsgHash && m.Value == m1.Value && m.RoundNum == m1.RoundNum
+}
+
+func describe(m *Message) string {
+	return fmt.Sprintf("id %d hash '%s' value '%s' round %d", m.ID, m.MsgHash, m.Value, m.RoundNum)
+}
+
+func (d Divergence) String() string {
+	e := d.Event
+	recorded := fmt.Sprintf("learned %v", e.Learned)
+	if e.Reply != nil {
+		recorded = fmt.Sprintf("answered %s", describe(e.Reply))
+	}
+	return fmt.Sprintf("clock %d, %s %s from %s in round %d: replayed PN %s, recorded PN %s", e.Clock, e.Direction, e.Kind, e.Peer, e.Round, d.Replayed, recorded)
+}
@@ -0,0 +1,119 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/**
+ * Cluster admission with a shared join token.
+ * The party being joined (the server, or an existing PN) hands out a random single-use challenge.
+ * The joiner answers with HMAC-SHA256(token, challenge | addr), so the token itself never goes over the wire,
+ * and an answer cannot be replayed, nor reused to admit a different address.
+ */
+
+// CHALLENGELEN is the number of random bytes in a challenge
+const CHALLENGELEN = 32
+
+// CHALLENGETTL is how long a challenge may stay unanswered
+const CHALLENGETTL = 30 * time.Second
+
+// JoinRequest asks to be admitted to the cluster as Addr
+type JoinRequest struct {
+	Addr      string
+	Challenge string
+	MAC       string
+}
+
+// JoinRequired is true when joiners must prove they know the cluster join token
+func (c *Config) JoinRequired() bool {
+	return c != nil && c.JoinToken != ""
+}
+
+// NewJoinRequest answers challenge for addr. Without a join token the MAC is left empty.
+func (c *Config) NewJoinRequest(addr string, challenge string) JoinRequest {
+	req := JoinRequest{Addr: addr, Challenge: challenge}
+	if c.JoinRequired() {
+		req.MAC = c.sign(challenge, addr)
+	}
+	return req
+}
+
+// CheckJoinRequest admits req if no token is required, or if it answers a challenge issued by challenges
+func (c *Config) CheckJoinRequest(challenges *Challenges, req JoinRequest) error {
+	if !c.JoinRequired() {
+		return nil
+	}
+	if !challenges.Redeem(req.Challenge) {
+		return fmt.Errorf("unknown or expired challenge from %s", req.Addr)
+	}
+	expected, err := hex.DecodeString(c.sign(req.Challenge, req.Addr))
+	if err != nil {
+		return err
+	}
+	given, err := hex.DecodeString(req.MAC)
+	if err != nil || !hmac.Equal(expected, given) {
+		return fmt.Errorf("bad join token from %s", req.Addr)
+	}
+	return nil
+}
+
+func (c *Config) sign(challenge string, addr string) string {
+	mac := hmac.New(sha256.New, []byte(c.JoinToken))
+	mac.Write([]byte(challenge))
+	mac.Write([]byte{0})
+	mac.Write([]byte(addr))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Challenges remembers the challenges handed out, so each can be answered only once
+type Challenges struct {
+	sync.Mutex
+	issued map[string]time.Time
+	now    func() time.Time
+}
+
+// NewChallenges creates an empty challenge store
+func NewChallenges() *Challenges {
+	return &Challenges{issued: make(map[string]time.Time), now: time.Now}
+}
+
+// SetClock makes the store tell the time with now rather than time.Now, e.g. to let challenges expire in tests
+func (c *Challenges) SetClock(now func() time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = now
+}
+
+// Issue a new random challenge
+func (c *Challenges) Issue() (string, error) {
+	nonce := make([]byte, CHALLENGELEN)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("unable to generate challenge: %s", err)
+	}
+	challenge := hex.EncodeToString(nonce)
+	c.Lock()
+	defer c.Unlock()
+	now := c.now()
+	for old, issued := range c.issued {
+		if now.Sub(issued) > CHALLENGETTL {
+			delete(c.issued, old)
+		}
+	}
+	c.issued[challenge] = now
+	return challenge, nil
+}
+
+// Redeem uses up challenge, reporting whether it was issued and has not expired
+func (c *Challenges) Redeem(challenge string) bool {
+	c.Lock()
+	defer c.Unlock()
+	issued, ok := c.issued[challenge]
+	delete(c.issued, challenge)
+	return ok && c.now().Sub(issued) <= CHALLENGETTL
+}
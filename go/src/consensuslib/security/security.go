@@ -0,0 +1,127 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"filelogger/vclock"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"time"
+)
+
+/**
+ * Config holds the optional security settings shared by the server, clients and paxos nodes.
+ * A nil Config, or one without TLS, keeps the original plain net/rpc over TCP.
+ * A JoinToken additionally limits who may register and become a neighbour, see admission.go.
+ *
+ * With TLS every connection is mutually authenticated: both ends present a certificate signed by
+ * the cluster CA. The certificate is also the peer's identity, a node may only claim the addresses
+ * listed in its certificate's subject alternative names.
+ */
+
+// HANDSHAKETIMEOUT bounds how long an incoming connection may take to present its certificate
+const HANDSHAKETIMEOUT = 5 * time.Second
+
+// Config for securing RPC traffic
+type Config struct {
+	TLS       *tls.Config
+	JoinToken string
+}
+
+// LoadTLSConfig builds a mutual TLS config from PEM files: this process's certificate and key,
+// and the CA certificate that every peer's certificate must be signed by
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load certificate and key: %s", err)
+	}
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA certificate: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// TLSEnabled is true when connections must use mutual TLS
+func (c *Config) TLSEnabled() bool {
+	return c != nil && c.TLS != nil
+}
+
+// Listen on addr, over TLS when enabled
+func (c *Config) Listen(addr string) (net.Listener, error) {
+	if c.TLSEnabled() {
+		return tls.Listen("tcp", addr, c.TLS)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// DialRPC opens an RPC connection to addr, over TLS when enabled.
+// The remote certificate must be valid for the host in addr.
+// The connection carries the vector clock of vlog, which may be nil when the process is not logging one.
+func (c *Config) DialRPC(addr string, vlog *vclock.Logger) (*rpc.Client, error) {
+	if !c.TLSEnabled() {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return vclock.NewClient(conn, vlog), nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := c.TLS.Clone()
+	config.ServerName = host
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return vclock.NewClient(conn, vlog), nil
+}
+
+// PeerCertificate completes the handshake on an accepted connection and returns the certificate the peer
+// presented. Plain TCP connections have no certificate, so nil is returned for them.
+func PeerCertificate(conn net.Conn) (*x509.Certificate, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+	tlsConn.SetDeadline(time.Now().Add(HANDSHAKETIMEOUT))
+	err := tlsConn.Handshake()
+	tlsConn.SetDeadline(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("TLS handshake with %s failed: %s", conn.RemoteAddr(), err)
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s presented no certificate", conn.RemoteAddr())
+	}
+	return certs[0], nil
+}
+
+// VerifyPeerAddr checks that a peer authenticated by cert may claim addr as its own
+func VerifyPeerAddr(cert *x509.Certificate, addr string) error {
+	if cert == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %s", addr, err)
+	}
+	if err = cert.VerifyHostname(host); err != nil {
+		return fmt.Errorf("certificate of %s does not cover %s", cert.Subject.CommonName, addr)
+	}
+	return nil
+}
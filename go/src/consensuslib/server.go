@@ -2,10 +2,14 @@ package consensuslib
 
 import (
 	"consensuslib/errors"
-	"filelogger/singletonlogger"
+	"consensuslib/security"
+	"crypto/x509"
+	"filelogger/logger"
+	"filelogger/vclock"
 	"fmt"
 	"net"
 	"net/rpc"
+	"sort"
 	"sync"
 	"time"
 )
@@ -14,12 +18,28 @@ import (
 type Server struct {
 	rpcServer *rpc.Server
 	listener  net.Listener
+	sec       *security.Config
+	vclock    *vclock.Logger
+
+	users     *AllUsers
+	config    HeartBeatConfig
+	deadlines deadlineHeap
+	wake      chan struct{}
+
+	challenges *security.Challenges
+	logger     *logger.Logger
+	metrics    *serverMetrics
 }
 
 // User represents a connected client
 type User struct {
 	Address   string
 	Heartbeat int64
+	State     NodeState
+
+	// when the sweeper next judges the user, and its position in the sweeper's deadline heap, kept up to date by the heap
+	deadline int64
+	index    int
 }
 
 // AllUsers is the collection of all our users
@@ -28,29 +48,90 @@ type AllUsers struct {
 	all map[string]*User
 }
 
-// HeartBeat is our heartbeat rate
-type HeartBeat uint32
+// NodeState is the server's belief about the liveness of a registered node
+type NodeState string
 
-var (
-	heartBeat HeartBeat = 2
-	allUsers            = AllUsers{all: make(map[string]*User)}
+const (
+	// Alive nodes have sent a heartbeat within SuspectAfter
+	Alive NodeState = "alive"
+	// Suspected nodes have been silent for SuspectAfter, but are still members
+	Suspected NodeState = "suspected"
+	// Dead nodes have been silent for DeadAfter and are removed from the membership
+	Dead NodeState = "dead"
 )
 
-// NewServer creates a new server ready to register paxosnodes
-func NewServer(addr string) (server *Server, err error) {
+// NodeStatus is a snapshot of a registered node, as returned by ListNodes
+type NodeStatus struct {
+	Address  string
+	LastSeen time.Time
+	State    NodeState
+}
+
+// HeartBeatConfig sets how long a node may stay silent before the server changes its mind about it
+type HeartBeatConfig struct {
+	SuspectAfter time.Duration
+	DeadAfter    time.Duration
+}
+
+// DefaultHeartBeatConfig keeps the original two second timeout before a node is dropped
+var DefaultHeartBeatConfig = HeartBeatConfig{
+	SuspectAfter: 1 * time.Second,
+	DeadAfter:    2 * time.Second,
+}
+
+// NewServer creates a new server ready to register paxosnodes.
+// When sec has TLS, every client must present a certificate covering the address it registers.
+// When sec has a JoinToken, every client must prove it knows the token before it is registered.
+// The server logs to log, or nowhere when log is nil.
+func NewServer(addr string, sec *security.Config, log *logger.Logger) (server *Server, err error) {
+	if log == nil {
+		log = logger.NewDiscardLogger("server" + addr)
+	}
 	server = &Server{
 		rpcServer: rpc.NewServer(),
+		sec:       sec,
+		users:     &AllUsers{all: make(map[string]*User)},
+		config:    DefaultHeartBeatConfig,
+		wake:      make(chan struct{}, 1),
+
+		challenges: security.NewChallenges(),
+		logger:     log,
 	}
+	server.metrics = newServerMetrics(server)
 	server.rpcServer.Register(server)
-	listener, err := net.Listen("tcp", addr)
+	listener, err := sec.Listen(addr)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create a listener on the server addres: %s", err)
 	}
 	server.listener = listener
-	singletonlogger.Info("Server started at " + listener.Addr().String())
+	go server.sweep()
+	log.Info("Server started at " + listener.Addr().String())
 	return server, nil
 }
 
+// LogVectorClocks logs the registrations and queries of every client with vector clocks, carried on every RPC,
+// to a ShiViz log in logs/. Heartbeats are left out of it. It must be called before Serve.
+func (s *Server) LogVectorClocks() (err error) {
+	s.vclock, err = vclock.NewLogger("server", s.listener.Addr().String())
+	if err != nil {
+		return fmt.Errorf("[ConsensusLib/serv] unable to log vector clocks: %s", err)
+	}
+	s.vclock.Ignore("Server.HeartBeat")
+	return nil
+}
+
+// SetHeartBeatConfig changes the suspicion levels used for every registered node, from their last heartbeat on
+func (s *Server) SetHeartBeatConfig(config HeartBeatConfig) error {
+	if config.SuspectAfter <= 0 || config.DeadAfter < config.SuspectAfter {
+		return fmt.Errorf("[ConsensusLib/serv] invalid heartbeat config: suspect after %v, dead after %v", config.SuspectAfter, config.DeadAfter)
+	}
+	s.users.Lock()
+	defer s.users.Unlock()
+	s.config = config
+	s.reschedule()
+	return nil
+}
+
 // Serve for clients
 func (s *Server) Serve() error {
 	for {
@@ -58,29 +139,83 @@ func (s *Server) Serve() error {
 		if err != nil {
 			return fmt.Errorf("[ConsensusLib/serv] Unable to accept connection: %s", err)
 		}
-		singletonlogger.Debug(fmt.Sprintf("[ConsensusLib/serv] Serving %s\n", s.listener.Addr().String()))
-		go s.rpcServer.ServeConn(conn)
+		s.logger.Debugf("[ConsensusLib/serv] Serving %s\n", s.listener.Addr().String())
+		if !s.sec.TLSEnabled() {
+			go vclock.ServeConn(s.rpcServer, conn, s.vclock)
+			continue
+		}
+		go s.serveAuthenticated(conn)
 	}
 }
 
+// serverSession is the RPC receiver for one authenticated connection.
+// It knows the caller's certificate, so it can check the addresses the caller claims.
+type serverSession struct {
+	*Server
+	peer *x509.Certificate
+}
+
+// serveAuthenticated serves a TLS connection with its own session
+func (s *Server) serveAuthenticated(conn net.Conn) {
+	cert, err := security.PeerCertificate(conn)
+	if err != nil {
+		s.logger.Warnf("[ConsensusLib/serv] Rejecting connection: %s", err)
+		conn.Close()
+		return
+	}
+	rpcServer := rpc.NewServer()
+	rpcServer.RegisterName("Server", &serverSession{Server: s, peer: cert})
+	vclock.ServeConn(rpcServer, conn, s.vclock)
+}
+
+// Register a client, if its certificate covers the address it registers
+func (ss *serverSession) Register(req security.JoinRequest, res *[]string) error {
+	if err := security.VerifyPeerAddr(ss.peer, req.Addr); err != nil {
+		ss.logger.Warnf("[ConsensusLib/serv] Refusing to register %s: %s", req.Addr, err)
+		return errors.PeerIdentityError(err.Error())
+	}
+	return ss.Server.Register(req, res)
+}
+
+// HeartBeat for a client, if its certificate covers the address it beats for
+func (ss *serverSession) HeartBeat(addr string, _ignored *bool) error {
+	if err := security.VerifyPeerAddr(ss.peer, addr); err != nil {
+		return errors.PeerIdentityError(err.Error())
+	}
+	return ss.Server.HeartBeat(addr, _ignored)
+}
+
+// Challenge hands out a single-use challenge, to be answered with the join token in Register
+func (s *Server) Challenge(addr string, challenge *string) (err error) {
+	*challenge, err = s.challenges.Issue()
+	return err
+}
+
 // Register a client with the server
-func (s *Server) Register(addr string, res *[]string) error {
-	allUsers.Lock()
-	defer allUsers.Unlock()
+func (s *Server) Register(req security.JoinRequest, res *[]string) error {
+	addr := req.Addr
+	if err := s.sec.CheckJoinRequest(s.challenges, req); err != nil {
+		s.logger.Warnf("[ConsensusLib/serv] Refusing to register %s: %s", addr, err)
+		return errors.JoinRefusedError(err.Error())
+	}
+
+	s.users.Lock()
+	defer s.users.Unlock()
 
-	if _, exists := allUsers.all[addr]; exists {
+	if _, exists := s.users.all[addr]; exists {
 		return errors.AddressAlreadyRegisteredError(addr)
 	}
-	allUsers.all[addr] = &User{
-		addr,
-		time.Now().UnixNano(),
+	user := &User{
+		Address:   addr,
+		Heartbeat: time.Now().UnixNano(),
+		State:     Alive,
 	}
-
-	go monitor(addr, time.Duration(heartBeat)*time.Second)
+	s.users.all[addr] = user
+	s.schedule(user)
 
 	neighbourAddresses := make([]string, 0)
 
-	for _, val := range allUsers.all {
+	for _, val := range s.users.all {
 		if addr == val.Address {
 			continue
 		}
@@ -88,7 +223,8 @@ func (s *Server) Register(addr string, res *[]string) error {
 	}
 	*res = neighbourAddresses
 
-	singletonlogger.Info(fmt.Sprintf("Got Register from %s", addr))
+	s.metrics.registrations.Inc()
+	s.logger.Infof("Got Register from %s", addr)
 
 	return nil
 
@@ -96,15 +232,19 @@ func (s *Server) Register(addr string, res *[]string) error {
 
 // HeartBeat from proj1 server.go implementation by Ivan Beschastnikh
 func (s *Server) HeartBeat(addr string, _ignored *bool) error {
-	allUsers.Lock()
-	defer allUsers.Unlock()
+	s.users.Lock()
+	defer s.users.Unlock()
 
-	if _, ok := allUsers.all[addr]; !ok {
-		// TODO: check right chanage
-		return errors.UnknownKeyError("")
+	user, ok := s.users.all[addr]
+	if !ok {
+		return errors.UnknownKeyError(addr)
 	}
 
-	allUsers.all[addr].Heartbeat = time.Now().UnixNano()
+	user.Heartbeat = time.Now().UnixNano()
+	if user.State == Suspected {
+		s.logger.Infof("%s is no longer suspected", addr)
+		user.State = Alive
+	}
 
 	return nil
 }
@@ -115,18 +255,20 @@ func (s *Server) CheckAlive(addr string, alive *bool) error {
 	return nil
 }
 
-// from proj1 server.go implementation by Ivan Beschastnikh, adapted by Graham Brown
-func monitor(k string, heartBeatInterval time.Duration) {
-	for {
-		allUsers.Lock()
-		if time.Now().UnixNano()-allUsers.all[k].Heartbeat > int64(heartBeatInterval) {
-			singletonlogger.Info(fmt.Sprintf("%s timed out", allUsers.all[k].Address))
-			delete(allUsers.all, k)
-			allUsers.Unlock()
-			return
-		}
-		singletonlogger.Info(fmt.Sprintf("%s is alive", allUsers.all[k].Address))
-		allUsers.Unlock()
-		time.Sleep(heartBeatInterval)
+// ListNodes returns every registered node with the time its last heartbeat arrived
+func (s *Server) ListNodes(placeholder string, res *[]NodeStatus) error {
+	s.users.RLock()
+	defer s.users.RUnlock()
+
+	nodes := make([]NodeStatus, 0, len(s.users.all))
+	for _, user := range s.users.all {
+		nodes = append(nodes, NodeStatus{
+			Address:  user.Address,
+			LastSeen: time.Unix(0, user.Heartbeat),
+			State:    user.State,
+		})
 	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Address < nodes[j].Address })
+	*res = nodes
+	return nil
 }
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"consensuslib"
+	"encoding/json"
+	"filelogger/logger"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	The diary over HTTP, with JSON bodies, for web frontends and scripts. It calls the same consensuslib.Client as the
+	CLI does:
+
+	POST /entries           {"value": "..."}, writes an entry and answers once it is committed
+	GET  /entries           ?offset=0&limit=100, the entries in slot order, a page at a time
+	GET  /entries/SLOT      the entry at SLOT
+	GET  /status            this node, its neighbours and the length of its log
+	GET  /members           every node registered with the server
+
+	Errors are answered with their status code and {"error": "..."}.
+*/
+
+// Paths of the endpoints
+const (
+	ENTRIES = "/entries"
+	STATUS  = "/status"
+	MEMBERS = "/members"
+)
+
+// DEFAULTLIMIT of entries on a page when no limit is given
+const DEFAULTLIMIT = 100
+
+// MAXLIMIT of entries on a page
+const MAXLIMIT = 1000
+
+// Entry at a slot of the log
+type Entry struct {
+	Slot  int    `json:"slot"`
+	Value string `json:"value"`
+}
+
+// Page of entries, from offset on
+type Page struct {
+	Total   int     `json:"total"`
+	Offset  int     `json:"offset"`
+	Limit   int     `json:"limit"`
+	Entries []Entry `json:"entries"`
+}
+
+// Status of this node
+type Status struct {
+	Addr         string      `json:"addr"`
+	ServerAlive  bool        `json:"serverAlive"`
+	Entries      int         `json:"entries"`
+	AtBreakpoint bool        `json:"atBreakpoint"`
+	Neighbours   []Neighbour `json:"neighbours"`
+}
+
+// Neighbour of this node and the state of the connection to it
+type Neighbour struct {
+	Addr      string    `json:"addr"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Member registered with the server
+type Member struct {
+	Addr     string    `json:"addr"`
+	State    string    `json:"state"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// NewEntry is the body of a POST to /entries
+type NewEntry struct {
+	Value string `json:"value"`
+}
+
+// Handler serves the API of a client
+type Handler struct {
+	client *consensuslib.Client
+	mux    *http.ServeMux
+	logger *logger.Logger
+}
+
+// NewHandler serves the API of client, logging requests to log
+func NewHandler(client *consensuslib.Client, log *logger.Logger) *Handler {
+	h := &Handler{client: client, mux: http.NewServeMux(), logger: log}
+	h.mux.HandleFunc(ENTRIES, h.entries)
+	h.mux.HandleFunc(ENTRIES+"/", h.entry)
+	h.mux.HandleFunc(STATUS, h.status)
+	h.mux.HandleFunc(MEMBERS, h.members)
+	return h
+}
+
+// Serve the API of client on addr, e.g. ":8000", until it fails
+func Serve(addr string, client *consensuslib.Client, log *logger.Logger) error {
+	log.Infof("[api] serving the diary at http://%s", addr)
+	err := http.ListenAndServe(addr, NewHandler(client, log))
+	return fmt.Errorf("[api] stopped serving: %s", err)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.logger.Debugf("[api] %s %s from %s", r.Method, r.URL, r.RemoteAddr)
+	h.mux.ServeHTTP(w, r)
+}
+
+// entries writes an entry on POST, and lists a page of them on GET
+func (h *Handler) entries(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.write(w, r)
+	case http.MethodGet:
+		h.page(w, r)
+	default:
+		h.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed on %s", r.Method, ENTRIES))
+	}
+}
+
+func (h *Handler) write(w http.ResponseWriter, r *http.Request) {
+	var body NewEntry
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.fail(w, http.StatusBadRequest, fmt.Errorf("expected {\"value\": \"...\"}: %s", err))
+		return
+	}
+	if body.Value == "" || strings.ContainsAny(body.Value, "\r\n") {
+		h.fail(w, http.StatusBadRequest, fmt.Errorf("the value must be one non-empty line"))
+		return
+	}
+	if len(h.client.Tracker().Paused()) > 0 {
+		h.fail(w, http.StatusConflict, fmt.Errorf("this node is at a breakpoint, continue it before writing again"))
+		return
+	}
+	if err := h.client.Write(body.Value); err != nil {
+		h.fail(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	h.reply(w, http.StatusCreated, body)
+}
+
+func (h *Handler) page(w http.ResponseWriter, r *http.Request) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", DEFAULTLIMIT)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit > MAXLIMIT {
+		limit = MAXLIMIT
+	}
+	total := h.client.Len()
+	entries, err := h.client.ReadRange(offset, offset+limit)
+	if err != nil {
+		h.fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	page := Page{Total: total, Offset: offset, Limit: limit, Entries: []Entry{}}
+	for _, e := range entries {
+		page.Entries = append(page.Entries, Entry{e.Slot, e.Value})
+	}
+	h.reply(w, http.StatusOK, page)
+}
+
+// entry at the slot in the path
+func (h *Handler) entry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	slot, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, ENTRIES+"/"))
+	if err != nil || slot < 0 {
+		h.fail(w, http.StatusBadRequest, fmt.Errorf("expected a slot number, got %s", r.URL.Path))
+		return
+	}
+	entries, err := h.client.ReadRange(slot, slot+1)
+	if err != nil {
+		h.fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(entries) == 0 {
+		h.fail(w, http.StatusNotFound, fmt.Errorf("no entry at slot %d, the log has %d", slot, h.client.Len()))
+		return
+	}
+	h.reply(w, http.StatusOK, Entry{entries[0].Slot, entries[0].Value})
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed on %s", r.Method, STATUS))
+		return
+	}
+	// an unreachable server is part of the status, not a failure to report it
+	alive, _ := h.client.IsAlive()
+	status := Status{
+		Addr:         h.client.Addr(),
+		ServerAlive:  alive,
+		Entries:      h.client.Len(),
+		AtBreakpoint: len(h.client.Tracker().Paused()) > 0,
+		Neighbours:   []Neighbour{},
+	}
+	for _, p := range h.client.Neighbours() {
+		status.Neighbours = append(status.Neighbours, Neighbour{p.Addr, string(p.State), p.Since, p.Attempts, p.LastError})
+	}
+	h.reply(w, http.StatusOK, status)
+}
+
+func (h *Handler) members(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed on %s", r.Method, MEMBERS))
+		return
+	}
+	nodes, err := h.client.ListNodes()
+	if err != nil {
+		h.fail(w, http.StatusBadGateway, err)
+		return
+	}
+	members := make([]Member, len(nodes))
+	for i, n := range nodes {
+		members[i] = Member{n.Address, string(n.State), n.LastSeen}
+	}
+	h.reply(w, http.StatusOK, members)
+}
+
+func (h *Handler) reply(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Debugf("[api] errored on replying: %s", err)
+	}
+}
+
+func (h *Handler) fail(w http.ResponseWriter, code int, err error) {
+	h.logger.Debugf("[api] answering %d: %s", code, err)
+	h.reply(w, code, map[string]string{"error": err.Error()})
+}
+
+// queryInt reads the non-negative integer parameter name of the query, def when it is not given
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a non-negative %s, got %s", name, value)
+	}
+	return n, nil
+}
@@ -13,28 +13,48 @@ package main
 
 import (
 	"consensuslib"
+	"consensuslib/paxosnode/faults"
+	"consensuslib/security"
+	"distributeddiaryapp/api"
 	"distributeddiaryapp/cli"
 	"distributeddiaryapp/networking"
+	"filelogger/level"
+	"filelogger/logger"
+	"filelogger/rotate"
 	"filelogger/singletonlogger"
 	"filelogger/state"
 	"fmt"
 	"os"
 	"paxostracker"
+	"paxostracker/breakpoint"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var validArgs = regexp.MustCompile("[0-9]{1,3}\\.[0-9]{1,3}\\.[0-9]{1,3}:[0-9]{1,5} [0-9]{1,5}( " + localFlag + ")*( " + debugFlag + ")*")
-var breaked bool
-var written bool
-var breakState, killState string
+var validArgs = regexp.MustCompile("[0-9]{1,3}\\.[0-9]{1,3}\\.[0-9]{1,3}:[0-9]{1,5} [0-9]{1,5}( " + localFlag + ")*( " + debugFlag + ")*( " + debugControlFlag + ")*( " + vclockFlag + ")*( " + jsonLogFlag + ")*( (" + gzipFlag + "|" + asyncFlag + "))*( (" + maxSizeFlag + "|" + maxAgeFlag + "|" + keepFlag + ") [0-9a-z.]+)*( (" + certFlag + "|" + keyFlag + "|" + caFlag + "|" + tokenFlag + "|" + syslogFlag + "|" + metricsFlag + "|" + httpFlag + "|" + traceFlag + ") [^ ]+)*")
 
 const (
-	debugFlag = "--debug"
-	localFlag = "--local"
-	usage     = `==================================================
+	debugFlag        = "--debug"
+	debugControlFlag = "--debug-control"
+	localFlag        = "--local"
+	certFlag         = "--cert"
+	keyFlag          = "--key"
+	caFlag           = "--ca"
+	tokenFlag        = "--token"
+	traceFlag        = "--trace"
+	vclockFlag       = "--vclock"
+	jsonLogFlag      = "--jsonlog"
+	maxSizeFlag      = "--log-max-size"
+	maxAgeFlag       = "--log-max-age"
+	keepFlag         = "--log-keep"
+	gzipFlag         = "--log-gzip"
+	asyncFlag        = "--log-async"
+	syslogFlag       = "--syslog"
+	metricsFlag      = "--metrics"
+	httpFlag         = "--http"
+	usage            = `==================================================
 The Chamber of Secrets: A Distributed Diary App
 ==================================================
 Usage: go run app.go serverAddress PORT [options]
@@ -45,28 +65,79 @@ Valid options:
 
 --local : run on local machine at 127.0.0.1 with the specified port
 --debug : run with debugging turned on for verbose logging
+--debug-control : let ddctl arm breakpoints, kill, step and inject faults on this node over its port, off by default
+--cert PATH --key PATH --ca PATH : use mutual TLS, with this node's certificate and key, and the cluster CA
+--token SECRET : prove knowledge of the cluster join token to the server and neighbours
+--trace PATH : record every paxos message this node sends or receives to PATH, for ddreplay
+--vclock : also log with vector clocks carried on every RPC, to a ShiViz log in logs/
+--jsonlog : also log every entry with its fields (node, round, msgID, peer, phase) as a JSON line, to a .jsonl log in logs/
+--log-max-size MB : start a new log file once the current one would grow past this many megabytes
+--log-max-age DURATION : start a new log file once the current one is this old, e.g. 24h
+--log-keep N : keep only the newest N files of each log, older runs' included, removing the oldest
+--log-gzip : gzip log files once a new one is started
+--log-async : write logs from a buffer in the background, flushed every second and on exit
+--syslog ADDR : also send log entries at info and above to the syslog server at ADDR over UDP, e.g. 127.0.0.1:514
+--metrics ADDR : serve Prometheus metrics over HTTP at http://ADDR/metrics, e.g. 127.0.0.1:9100
+--http ADDR : serve the diary as a JSON API over HTTP at http://ADDR instead of the command line, e.g. 127.0.0.1:8000
 `
 )
 
+// RECENTERRORS is how many of the last errors the errors command lists
+const RECENTERRORS = 50
+
+var recentErrors = logger.NewRingSink(RECENTERRORS)
+
 func main() {
 	// Parse command line arguments
-	serverAddr, localAddr, outboundAddr, logstate, err := parseArgs(os.Args[1:])
+	serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, err := parseArgs(os.Args[1:])
 	checkError(err)
 
 	// Create our logger
-	err = singletonlogger.NewSingletonLogger("app", logstate)
+	err = singletonlogger.NewRotatingSingletonLogger("app", logstate, rotation)
 	checkError(err)
+	if jsonLogs {
+		err = singletonlogger.EnableJSON()
+		checkError(err)
+	}
+	checkError(singletonlogger.AddSink(recentErrors, level.ERROR))
+	if syslogAddr != "" {
+		syslog, err := logger.NewSyslogSink(syslogAddr, "app")
+		checkError(err)
+		checkError(singletonlogger.AddSink(syslog, level.INFO))
+	}
 	singletonlogger.Debug("[LIB/APP] starting application at " + localAddr + " with outbound address " + outboundAddr)
 
 	// Create a new ConsensusLib client
-	client, err := consensuslib.NewClient(localAddr, outboundAddr, 1*time.Millisecond)
+	client, err := consensuslib.NewClient(localAddr, outboundAddr, 1*time.Millisecond, sec, singletonlogger.Get())
 	checkError(err)
 	singletonlogger.Debug("[LIB/APP] created client at " + localAddr)
 
+	if debugControl {
+		client.EnableDebugControl()
+	}
+	if vectorClocks {
+		err = client.LogVectorClocks()
+		checkError(err)
+	}
+	if tracePath != "" {
+		err = client.RecordTrace(tracePath)
+		checkError(err)
+		singletonlogger.Debug("[LIB/APP] recording paxos trace to " + tracePath)
+	}
+	if metricsAddr != "" {
+		_, err = client.ServeMetrics(metricsAddr)
+		checkError(err)
+	}
+
 	// Connect to the ConsensusLib server at serverAddr
 	err = client.Connect(serverAddr)
 	checkError(err)
 	singletonlogger.Debug("[LIB/APP] connected to server at " + serverAddr)
+
+	if httpAddr != "" {
+		// Serve the Distributed Diary app over HTTP
+		checkError(api.Serve(httpAddr, client, singletonlogger.Get()))
+	}
 	singletonlogger.Debug("[LIB/APP] serving cli")
 
 	// Serve the CLI interface to the Distributed Diary app
@@ -74,24 +145,32 @@ func main() {
 }
 
 func serveCli(client *consensuslib.Client) {
+	tracker := client.Tracker()
+	var unfollow func()
 	for {
 		command := cli.Run()
-		singletonlogger.Debug(fmt.Sprintf("[app] received command %v", command))
+		singletonlogger.Debugf("[app] received command %v", command)
 		switch command.Command {
 		case cli.ALIVE:
 			isAlive, err := client.IsAlive()
 			checkError(err)
-			singletonlogger.Info(fmt.Sprintf("Alive: %v", isAlive))
+			singletonlogger.Infof("Alive: %v", isAlive)
 		case cli.EXIT:
 			Exit()
 		case cli.READ:
+			if command.Data != nil {
+				readRange(client, *command.Data)
+				break
+			}
 			value, err := client.Read()
 			checkError(err)
-			singletonlogger.Info(fmt.Sprintf("Reading: \n%s", value))
+			singletonlogger.Infof("Reading: \n%s", value)
+		case cli.COUNT:
+			singletonlogger.Infof("%d entries", client.Len())
+		case cli.SEARCH:
+			search(client, *command.Data)
 		case cli.WRITE:
-			if breaked && !written {
-				written = true
-			} else if breaked && written {
+			if len(tracker.Paused()) > 0 {
 				singletonlogger.Info("This client is at a breakpoint. Please 'continue' before writing again.")
 				break
 			}
@@ -105,105 +184,204 @@ func serveCli(client *consensuslib.Client) {
 				}
 			}
 			go client.Write(value)
-		case cli.BREAK:
-			if breaked && !written {
-				singletonlogger.Info("This client is ready to hit a breakpoint. Please 'continue' before pausing again.")
-				break
-			} else if breaked && written {
-				singletonlogger.Info("This client is at a breakpoint. Please 'continue' before pausing again.")
+		case cli.BREAK, cli.KILL:
+			b, err := breakpoint.Parse(*command.Data)
+			if err != nil {
+				singletonlogger.Errorf("Couldn't identify '%s': %s", strings.Join(*command.Data, " "), err)
 				break
 			}
-			breaked = true
-			data := *command.Data
-			breakState = data[0]
-			singletonlogger.Info("Breaking before next " + breakState)
-			switch breakState {
-			case cli.Prepare:
-				go paxostracker.BreakNextPrepare()
-			case cli.Propose:
-				go paxostracker.BreakNextPropose()
-			case cli.Learn:
-				go paxostracker.BreakNextLearn()
-			case cli.Idle:
-				go paxostracker.BreakNextIdle()
-			case cli.Custom:
-				go paxostracker.BreakNextCustom()
-			default:
-				singletonlogger.Error(fmt.Sprintf("Couldn't identify '%s'", breakState))
-				breaked = false
-			}
-		case cli.KILL:
-			data := *command.Data
-			killState = data[0]
-			singletonlogger.Info("Killing before next " + killState)
-			switch killState {
-			case cli.Prepare:
-				go paxostracker.KillNextPrepare()
-			case cli.Propose:
-				go paxostracker.KillNextPropose()
-			case cli.Learn:
-				go paxostracker.KillNextLearn()
-			case cli.Idle:
-				go paxostracker.KillNextIdle()
-			case cli.Custom:
-				go paxostracker.KillNextCustom()
-			default:
-				singletonlogger.Error(fmt.Sprintf("Couldn't identify '%s'", killState))
+			b.Kill = command.Command == cli.KILL
+			b.ID = tracker.Break(b)
+			singletonlogger.Infof("Armed breakpoint %v", b)
+		case cli.BREAKPOINTS:
+			breakpoints := tracker.Breakpoints()
+			if len(breakpoints) == 0 {
+				singletonlogger.Info("No breakpoints armed")
+			}
+			for _, b := range breakpoints {
+				singletonlogger.Info(b.String())
 			}
+			for _, ctx := range tracker.Paused() {
+				singletonlogger.Infof("Paused before %v", ctx)
+			}
+		case cli.DELETE:
+			id, _ := strconv.Atoi((*command.Data)[0])
+			if err := tracker.Delete(id); err != nil {
+				singletonlogger.Error(err.Error())
+				break
+			}
+			singletonlogger.Infof("Deleted breakpoint %d", id)
 		case cli.CONTINUE:
-			breaked = false
-			written = false
+			if err := tracker.Continue(); err != nil {
+				singletonlogger.Info("Unable to continue: Not at a breakpoint!")
+				break
+			}
 			singletonlogger.Info("Continuing...")
-			go paxostracker.Continue()
 		case cli.ROUNDS:
-			singletonlogger.Info(paxostracker.AsTable())
+			if command.Data != nil && (*command.Data)[0] == cli.CLUSTER {
+				singletonlogger.Info(paxostracker.TimelineAsTable(client.ClusterRounds()))
+				break
+			}
+			singletonlogger.Info(tracker.AsTable())
 		case cli.STEP:
-			if !breaked {
+			next, err := tracker.Step()
+			if err != nil {
 				singletonlogger.Info("Unable to step: Not at a breakpoint!")
 				break
 			}
-			switch breakState {
-			case cli.Prepare:
-				singletonlogger.Info("Breaking before next Propose")
-				breakState = cli.Propose
-				go paxostracker.BreakNextPropose()
-				go paxostracker.Continue()
-			case cli.Propose:
-				singletonlogger.Info("Breaking before next Learn")
-				breakState = cli.Learn
-				go paxostracker.BreakNextLearn()
-				go paxostracker.Continue()
-			case cli.Learn:
-				singletonlogger.Info("Breaking before next Idle")
-				breakState = cli.Idle
-				go paxostracker.BreakNextIdle()
-				go paxostracker.Continue()
-			case cli.Idle:
-				singletonlogger.Info("Cannot step beyond Idle. Please 'continue'")
-			default:
-				singletonlogger.Error(fmt.Sprintf("Couldn't identify '%s'", breakState))
+			if len(next) == 0 {
+				singletonlogger.Info("Stepped beyond the end of the round, continuing...")
+				break
+			}
+			singletonlogger.Infof("Breaking at the next of %s", breakpoint.Join(next))
+		case cli.LOGLEVEL:
+			setLogLevel(*command.Data)
+		case cli.ERRORS:
+			errors := recentErrors.Records()
+			if len(errors) == 0 {
+				singletonlogger.Info("No errors logged")
+			}
+			for _, r := range errors {
+				singletonlogger.Infof("%s %s", r.Time.Format("15:04:05.000"), r)
 			}
+		case cli.FOLLOW:
+			if unfollow != nil {
+				singletonlogger.Info("Already following the diary")
+				break
+			}
+			unfollow = follow(client)
+			singletonlogger.Info("Following the diary, 'unfollow' to stop")
+		case cli.UNFOLLOW:
+			if unfollow == nil {
+				singletonlogger.Info("Not following the diary")
+				break
+			}
+			unfollow()
+			unfollow = nil
+			singletonlogger.Info("Stopped following the diary")
+		case cli.FAULT:
+			rule, err := faults.Parse(*command.Data)
+			if err != nil {
+				singletonlogger.Errorf("Couldn't identify '%s': %s", strings.Join(*command.Data, " "), err)
+				break
+			}
+			client.Faults().Set(rule)
+			singletonlogger.Infof("Injecting faults %v", rule)
+		case cli.FAULTS:
+			rules := client.Faults().Rules()
+			if len(rules) == 0 {
+				singletonlogger.Info("No faults injected")
+			}
+			for _, r := range rules {
+				singletonlogger.Info(r.String())
+			}
+		case cli.PARTITION:
+			client.Faults().Partition(*command.Data)
+			singletonlogger.Infof("Partitioned from %s", strings.Join(*command.Data, " "))
+		case cli.HEAL:
+			client.Faults().Heal(*command.Data)
+			if len(*command.Data) == 0 {
+				singletonlogger.Info("Healed every fault")
+				break
+			}
+			singletonlogger.Infof("Healed faults to %s", strings.Join(*command.Data, " "))
 		default:
 		}
 	}
 }
 
+// readRange handles 'read FROM TO', printing the entries in slots FROM up to, but not including, TO
+func readRange(client *consensuslib.Client, bounds []string) {
+	from, _ := strconv.Atoi(bounds[0])
+	to, _ := strconv.Atoi(bounds[1])
+	entries, err := client.ReadRange(from, to)
+	if err != nil {
+		singletonlogger.Error(err.Error())
+		return
+	}
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = fmt.Sprintf("[%d] %s", e.Slot, e.Value)
+	}
+	singletonlogger.Infof("Reading %d of %d entries: \n%s", len(entries), client.Len(), strings.Join(lines, "\n"))
+}
+
+// search handles 'search TERMS', printing the slot and a snippet of every entry found
+func search(client *consensuslib.Client, terms []string) {
+	query := strings.Join(terms, " ")
+	hits, err := client.Search(query)
+	if err != nil {
+		singletonlogger.Error(err.Error())
+		return
+	}
+	if len(hits) == 0 {
+		singletonlogger.Infof("No entries found for '%s'", query)
+		return
+	}
+	lines := make([]string, len(hits))
+	for i, h := range hits {
+		lines[i] = fmt.Sprintf("[%d] %s", h.Slot, h.Snippet)
+	}
+	singletonlogger.Infof("Found %d entries for '%s': \n%s", len(hits), query, strings.Join(lines, "\n"))
+}
+
+// follow prints the entries other users write from the end of the log on, until the returned func is called
+func follow(client *consensuslib.Client) (unfollow func()) {
+	learned, cancel := client.Subscribe(client.Len())
+	go func() {
+		for e := range learned {
+			if e.Proposer != client.Addr() {
+				singletonlogger.Infof("[%d] %s: %s", e.Slot, e.Proposer, e.Value)
+			}
+		}
+	}()
+	return cancel
+}
+
+// setLogLevel handles 'loglevel [[COMPONENT]] LEVEL', listing the levels set when there are no args
+func setLogLevel(args []string) {
+	if len(args) == 0 {
+		singletonlogger.Info("Log levels:\n" + strings.Join(singletonlogger.Levels(), "\n"))
+		return
+	}
+	component := logger.DEFAULT
+	if len(args) == 2 {
+		component = args[0]
+	}
+	if args[len(args)-1] == cli.DEFAULTLEVEL {
+		checkError(singletonlogger.ResetLevel(component))
+		singletonlogger.Infof("Logging %s at the default level", component)
+		return
+	}
+	min, err := level.Parse(args[len(args)-1])
+	if err != nil {
+		singletonlogger.Error(err.Error())
+		return
+	}
+	checkError(singletonlogger.SetLevel(component, min))
+	singletonlogger.Infof("Logging %s at %s and above", component, min.Name())
+}
+
 // Exit nicely from the program
 func Exit() {
 	// TODO: Delete temp folder
 	singletonlogger.Info("Closing the Chamber of Secrets...")
 	singletonlogger.Info("Goodbye!")
+	singletonlogger.Exit()
 	os.Exit(0)
 }
 
-func parseArgs(args []string) (serverAddr string, localAddr string, outboundAddr string, logstate state.State, err error) {
+func parseArgs(args []string) (serverAddr string, localAddr string, outboundAddr string, logstate state.State, sec *security.Config, tracePath string, vectorClocks bool, jsonLogs bool, syslogAddr string, metricsAddr string, httpAddr string, debugControl bool, rotation rotate.Config, err error) {
 	if !validArgs.MatchString(strings.Join(args, " ")) {
 		fmt.Println(usage)
 		os.Exit(1)
 	}
 	port := 0
 	isLocal := false
-	for i, arg := range args {
+	tlsFiles := make(map[string]string)
+	joinToken := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
 		// positional args
 		switch i {
 		case 0:
@@ -211,7 +389,7 @@ func parseArgs(args []string) (serverAddr string, localAddr string, outboundAddr
 		case 1:
 			port, err = strconv.Atoi(args[i])
 			if err != nil {
-				return serverAddr, localAddr, outboundAddr, logstate, fmt.Errorf("error while converting port: %s", err)
+				return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("error while converting port: %s", err)
 			}
 		default:
 			// option flags
@@ -220,9 +398,68 @@ func parseArgs(args []string) (serverAddr string, localAddr string, outboundAddr
 				isLocal = true
 			case debugFlag:
 				logstate = state.DEBUGGING
+			case debugControlFlag:
+				debugControl = true
+			case vclockFlag:
+				vectorClocks = true
+			case jsonLogFlag:
+				jsonLogs = true
+			case gzipFlag:
+				rotation.Compress = true
+			case asyncFlag:
+				rotation.Async = true
+			case maxSizeFlag, maxAgeFlag, keepFlag:
+				if i+1 >= len(args) {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("missing value after %s", arg)
+				}
+				i++
+				err = rotationFromFlag(&rotation, arg, args[i])
+				if err != nil {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, err
+				}
+			case certFlag, keyFlag, caFlag:
+				if i+1 >= len(args) {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("missing path after %s", arg)
+				}
+				i++
+				tlsFiles[arg] = args[i]
+			case httpFlag:
+				if i+1 >= len(args) {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("missing address after %s", arg)
+				}
+				i++
+				httpAddr = args[i]
+			case metricsFlag:
+				if i+1 >= len(args) {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("missing address after %s", arg)
+				}
+				i++
+				metricsAddr = args[i]
+			case syslogFlag:
+				if i+1 >= len(args) {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("missing address after %s", arg)
+				}
+				i++
+				syslogAddr = args[i]
+			case tokenFlag:
+				if i+1 >= len(args) {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("missing secret after %s", arg)
+				}
+				i++
+				joinToken = args[i]
+			case traceFlag:
+				if i+1 >= len(args) {
+					return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("missing path after %s", arg)
+				}
+				i++
+				tracePath = args[i]
 			}
 		}
 	}
+	sec, err = securityFromFlags(tlsFiles, joinToken)
+	if err != nil {
+		return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, err
+	}
 	addrEnd := fmt.Sprintf(":%d", port)
 	if isLocal {
 		localAddr = "127.0.0.1" + addrEnd
@@ -230,18 +467,61 @@ func parseArgs(args []string) (serverAddr string, localAddr string, outboundAddr
 	} else {
 		outboundIP, err := networking.GetOutboundIP()
 		if err != nil {
-			return serverAddr, localAddr, outboundAddr, logstate, fmt.Errorf("error while fetching ip: %s", err)
+			return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, fmt.Errorf("error while fetching ip: %s", err)
 		}
 		outboundAddr = outboundIP + addrEnd
 		localAddr = addrEnd
 
 	}
-	return serverAddr, localAddr, outboundAddr, logstate, nil
+	return serverAddr, localAddr, outboundAddr, logstate, sec, tracePath, vectorClocks, jsonLogs, syslogAddr, metricsAddr, httpAddr, debugControl, rotation, nil
+}
+
+// securityFromFlags loads mutual TLS when all of --cert, --key and --ca were given, and sets the join token
+func securityFromFlags(tlsFiles map[string]string, joinToken string) (sec *security.Config, err error) {
+	if len(tlsFiles) == 0 && joinToken == "" {
+		return nil, nil
+	}
+	sec = &security.Config{JoinToken: joinToken}
+	if len(tlsFiles) == 0 {
+		return sec, nil
+	}
+	if len(tlsFiles) != 3 {
+		return nil, fmt.Errorf("%s, %s and %s must be given together", certFlag, keyFlag, caFlag)
+	}
+	sec.TLS, err = security.LoadTLSConfig(tlsFiles[certFlag], tlsFiles[keyFlag], tlsFiles[caFlag])
+	if err != nil {
+		return nil, fmt.Errorf("error while loading TLS config: %s", err)
+	}
+	return sec, nil
+}
+
+// rotationFromFlag sets the part of rotation given by the flag arg
+func rotationFromFlag(rotation *rotate.Config, arg string, value string) (err error) {
+	switch arg {
+	case maxSizeFlag:
+		megabytes, err := strconv.ParseFloat(value, 64)
+		if err != nil || megabytes <= 0 {
+			return fmt.Errorf("error while converting %s: %s is not a positive number of megabytes", arg, value)
+		}
+		rotation.MaxSize = int64(megabytes * 1024 * 1024)
+	case maxAgeFlag:
+		rotation.MaxAge, err = time.ParseDuration(value)
+		if err != nil || rotation.MaxAge <= 0 {
+			return fmt.Errorf("error while converting %s: %s is not a positive duration", arg, value)
+		}
+	case keepFlag:
+		rotation.MaxFiles, err = strconv.Atoi(value)
+		if err != nil || rotation.MaxFiles <= 0 {
+			return fmt.Errorf("error while converting %s: %s is not a positive number of files", arg, value)
+		}
+	}
+	return nil
 }
 
 func checkError(err error) {
 	if err != nil {
 		singletonlogger.Fatal(err.Error())
+		singletonlogger.Exit()
 		os.Exit(1)
 	}
 }
@@ -16,16 +16,35 @@ type Command struct {
 
 // Commands
 const (
-	ALIVE    = "alive"
-	EXIT     = "exit"
-	READ     = "read"
-	WRITE    = "write"
-	HELP     = "help"
-	ROUNDS   = "rounds"
-	BREAK    = "break"
-	CONTINUE = "continue"
-	STEP     = "step"
-	KILL     = "kill"
+	ALIVE       = "alive"
+	EXIT        = "exit"
+	READ        = "read"
+	COUNT       = "count"
+	SEARCH      = "search"
+	WRITE       = "write"
+	HELP        = "help"
+	ROUNDS      = "rounds"
+	BREAK       = "break"
+	CONTINUE    = "continue"
+	STEP        = "step"
+	KILL        = "kill"
+	BREAKPOINTS = "breakpoints"
+	DELETE      = "delete"
+	FAULT       = "fault"
+	FAULTS      = "faults"
+	PARTITION   = "partition"
+	HEAL        = "heal"
+	LOGLEVEL    = "loglevel"
+	ERRORS      = "errors"
+	FOLLOW      = "follow"
+	UNFOLLOW    = "unfollow"
+)
+
+// Flags
+const (
+	CLUSTER = "--cluster"
+	// DEFAULTLEVEL makes a component log at the default level again
+	DEFAULTLEVEL = "default"
 )
 
 // Breaks
@@ -35,9 +54,11 @@ const (
 	Learn   = "learn"
 	Idle    = "idle"
 	Custom  = "custom"
+	Promise = "promise"
+	Accept  = "accept"
 )
 
-var validCommand = regexp.MustCompile("(alive|read|write ([0-9a-zA-Z ]*)?|help|exit|rounds|(break|kill) (prepare|propose|learn|idle|custom)|continue|step)")
+var validCommand = regexp.MustCompile("^(alive|read( [0-9]+ [0-9]+)?|count|search [0-9a-zA-Z ]+|write ([0-9a-zA-Z ]*)?|help|exit|errors|follow|unfollow|rounds( --cluster)?|breakpoints|(break|kill) (prepare|reply|propose|learn|idle|custom|promise|accept|notify)( (round|above) [0-9]+| (value|peer) [^ ]+| always)*|delete [0-9]+|continue|step|faults|fault [^ ]+( (drop|dropreply|delay) [0-9]+| duplicate| partition)*|partition( [^ ]+)+|heal( [^ ]+)*|loglevel(( \\[[^ \\]]+\\])? (debug|info|warning|error|fatal|default))?)$")
 
 var helpString = `
 ===========================================
@@ -57,25 +78,55 @@ help
 ----
 - display this text
 
-read
-----
+read [FROM TO]
+--------------
 - read the current log value of the application
+- with FROM and TO, only the entries in slots FROM up to, but not including, TO, each with its slot
+
+count
+-----
+- count the entries in the log
+
+search TERMS
+------------
+- list the slots of the entries with every one of the words in TERMS, regardless of case, with a snippet of each
 
 write [a-zA-Z0-9 ]?
 -------------------
 - write to the log a string consisiting of one or more lower and upper case letters, 0-9, and spaces.
 
-rounds
--------
-- produce the round results from the paxostracker
+rounds [--cluster]
+------------------
+- produce the round results from the paxostracker, with the nodes seen to promise, accept and learn in each round
+- with --cluster, merge the rounds of every node into one timeline showing, per round, who proposed,
+  the promise and accept counts, how long each phase took at the proposer, and any conflicts
 
-break [prepare|propose|learn|idle|custom]
-----------------------------------
+break [prepare|reply|propose|learn|idle|custom|promise|accept|notify] [conditions]
+---------------------------------------------------------------------------------
 - break the client's execution at the selected stage for the next round until 'continue' is called
+- promise and accept are reached when this client's acceptor answers a proposer
+- reply is reached after each neighbour's reply to this client's prepare or accept request is counted,
+  notify after each notice that an acceptor accepted is counted by this client's learner
+- conditions, in any order, limit which round is broken in:
+    round N      only in round (slot) N
+    above N      only for proposal IDs above N
+    value TEXT   only when the value contains TEXT
+    peer ADDR    only for messages from the node at ADDR
+    always       stay armed after breaking, instead of only breaking once
+- several breakpoints can be armed at once, each gets an ID
 
-kill [prepare|propose|learn|idle|custom]
-----------------------------------
+kill [prepare|reply|propose|learn|idle|custom|promise|accept|notify] [conditions]
+--------------------------------------------------------------------------------
 - kill the client's execution at the selected stage. Exits roughly with os.Exit(1).
+- takes the same conditions as break
+
+breakpoints
+-----------
+- list the armed breakpoints by ID, and where the client is paused
+
+delete N
+--------
+- disarm the breakpoint with ID N
 
 continue
 --------
@@ -83,7 +134,49 @@ continue
 
 step
 ----
-- step one stage further
+- step one stage further, stopping at each reply and notice counted on the way, so partial quorums can be watched
+
+fault PEER [drop N] [dropreply N] [delay MS] [duplicate] [partition]
+--------------------------------------------------------------------
+- inject faults into the calls this client makes to the node at PEER, or to every node without its own rule if PEER is *
+    drop N       N% of calls are lost before they are sent, and time out
+    dropreply N  N% of calls are handled by PEER but their replies are lost, and time out
+    delay MS     calls are sent MS milliseconds late
+    duplicate    calls are sent twice
+    partition    every call is lost, and times out
+- replaces any faults PEER had. Faults only apply to this client's calls, set them on both sides for a clean split
+
+faults
+------
+- list the fault rules
+
+partition PEER [PEER...]
+------------------------
+- partition this client from every node given, keeping their other faults
+
+heal [PEER...]
+--------------
+- remove the fault rules for the nodes given, or every rule and partition if none are
+
+follow
+------
+- print the entries other users write to the diary as they are committed, until 'unfollow'
+
+unfollow
+--------
+- stop printing the entries of other users
+
+errors
+------
+- list the last errors this client logged, the oldest first
+
+loglevel [[COMPONENT]] LEVEL
+----------------------------
+- log only the messages at LEVEL (debug, info, warning, error or fatal) or above, the messages of COMPONENT if given
+- components are the prefixes of the messages, e.g. [paxosnode] or [Acceptor], regardless of case
+- without COMPONENT, sets the default level of every component without its own level, including the replies of this app
+- LEVEL default makes COMPONENT use the default level again
+- loglevel alone lists the levels set
 
 Created for:
 CPSC 416 Distributed Systems, in the 2017W2 Session at the University of British Columbia (UBC)
@@ -105,23 +198,66 @@ func Run() (cmd Command) {
 				writeArgs := strings.Split(command[0], " ")[1:]
 				return Command{WRITE, &writeArgs}
 			case 'b':
+				if command[0] == BREAKPOINTS {
+					return Command{BREAKPOINTS, nil}
+				}
 				when := strings.Split(command[0], " ")[1:]
 				return Command{BREAK, &when}
+			case 'd':
+				id := strings.Split(command[0], " ")[1:]
+				return Command{DELETE, &id}
 			case 'k':
 				when := strings.Split(command[0], " ")[1:]
 				return Command{KILL, &when}
+			case 'f':
+				if command[0] == FAULTS {
+					return Command{FAULTS, nil}
+				}
+				if command[0] == FOLLOW {
+					return Command{FOLLOW, nil}
+				}
+				rule := strings.Split(command[0], " ")[1:]
+				return Command{FAULT, &rule}
+			case 'p':
+				peers := strings.Split(command[0], " ")[1:]
+				return Command{PARTITION, &peers}
+			case 'h':
+				if command[0] == HELP {
+					fmt.Println(helpString)
+					break
+				}
+				peers := strings.Split(command[0], " ")[1:]
+				return Command{HEAL, &peers}
+			case 'l':
+				levels := strings.Split(command[0], " ")[1:]
+				return Command{LOGLEVEL, &levels}
 			default:
+				if strings.HasPrefix(command[0], READ+" ") {
+					bounds := strings.Split(command[0], " ")[1:]
+					return Command{READ, &bounds}
+				}
+				if strings.HasPrefix(command[0], SEARCH+" ") {
+					terms := strings.Fields(command[0])[1:]
+					return Command{SEARCH, &terms}
+				}
 				switch command[0] {
 				case ALIVE:
 					return Command{ALIVE, nil}
 				case READ:
 					return Command{READ, nil}
+				case COUNT:
+					return Command{COUNT, nil}
 				case EXIT:
 					return Command{EXIT, nil}
-				case HELP:
-					fmt.Println(helpString)
+				case ERRORS:
+					return Command{ERRORS, nil}
+				case UNFOLLOW:
+					return Command{UNFOLLOW, nil}
 				case ROUNDS:
 					return Command{ROUNDS, nil}
+				case ROUNDS + " " + CLUSTER:
+					cluster := []string{CLUSTER}
+					return Command{ROUNDS, &cluster}
 				case CONTINUE:
 					return Command{CONTINUE, nil}
 				case STEP:
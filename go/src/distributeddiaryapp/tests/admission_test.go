@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"consensuslib/security"
+	"testing"
+	"time"
+)
+
+func TestJoinRequestRejected(t *testing.T) {
+	now := time.Now()
+	challenges := security.NewChallenges()
+	challenges.SetClock(func() time.Time { return now })
+	cluster := &security.Config{JoinToken: "the cluster's token"}
+	addr := "127.0.0.1:12528"
+
+	issue := func() string {
+		challenge, err := challenges.Issue()
+		if err != nil {
+			t.Fatalf("Bad Exit: unable to issue a challenge: %v", err)
+		}
+		return challenge
+	}
+
+	valid := cluster.NewJoinRequest(addr, issue())
+	if err := cluster.CheckJoinRequest(challenges, valid); err != nil {
+		t.Fatalf("Bad Exit: expected a join request with the token to be admitted, got %v", err)
+	}
+	if err := cluster.CheckJoinRequest(challenges, valid); err == nil {
+		t.Errorf("Bad Exit: expected a replayed join request to be rejected")
+	}
+
+	wrong := &security.Config{JoinToken: "a guess"}
+	if err := cluster.CheckJoinRequest(challenges, wrong.NewJoinRequest(addr, issue())); err == nil {
+		t.Errorf("Bad Exit: expected a join request with the wrong token to be rejected")
+	}
+
+	var none *security.Config
+	if err := cluster.CheckJoinRequest(challenges, none.NewJoinRequest(addr, issue())); err == nil {
+		t.Errorf("Bad Exit: expected a join request without a token to be rejected")
+	}
+
+	other := cluster.NewJoinRequest("127.0.0.1:12529", issue())
+	other.Addr = addr
+	if err := cluster.CheckJoinRequest(challenges, other); err == nil {
+		t.Errorf("Bad Exit: expected a join request answered for another address to be rejected")
+	}
+
+	if err := cluster.CheckJoinRequest(challenges, cluster.NewJoinRequest(addr, "never issued")); err == nil {
+		t.Errorf("Bad Exit: expected a join request answering an unknown challenge to be rejected")
+	}
+
+	late := cluster.NewJoinRequest(addr, issue())
+	now = now.Add(security.CHALLENGETTL + time.Second)
+	if err := cluster.CheckJoinRequest(challenges, late); err == nil {
+		t.Errorf("Bad Exit: expected a join request answering an expired challenge to be rejected")
+	}
+}
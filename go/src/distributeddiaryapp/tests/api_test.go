@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"distributeddiaryapp/api"
+	"distributeddiaryapp/tests/util"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	serverAddr := "127.0.0.1:12508"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestAPI\" produced err: %v", err)
+	}
+	client, err := util.SetupClient(serverAddr, "127.0.0.1:12509")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestAPI\" produced err: %v", err)
+	}
+	log, err := util.NodeLogger("api", "127.0.0.1:12509")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestAPI\" produced err: %v", err)
+	}
+	web := httptest.NewServer(api.NewHandler(client, log))
+	defer web.Close()
+
+	for _, value := range []string{"first", "second", "third"} {
+		resp, err := http.Post(web.URL+api.ENTRIES, "application/json", strings.NewReader(`{"value": "`+value+`"}`))
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestAPI\" produced err: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Bad Exit: expected %d for writing %s, got %d", http.StatusCreated, value, resp.StatusCode)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	var page api.Page
+	getJSON(t, web.URL+api.ENTRIES+"?offset=1&limit=1", http.StatusOK, &page)
+	if page.Total != 3 || len(page.Entries) != 1 || page.Entries[0] != (api.Entry{Slot: 1, Value: "second"}) {
+		t.Errorf("Bad Exit: expected the second of 3 entries, got %+v", page)
+	}
+	var entry api.Entry
+	getJSON(t, web.URL+api.ENTRIES+"/2", http.StatusOK, &entry)
+	if entry.Value != "third" {
+		t.Errorf("Bad Exit: expected the third entry at slot 2, got %+v", entry)
+	}
+	getJSON(t, web.URL+api.ENTRIES+"/3", http.StatusNotFound, nil)
+	var status api.Status
+	getJSON(t, web.URL+api.STATUS, http.StatusOK, &status)
+	if status.Addr != "127.0.0.1:12509" || !status.ServerAlive || status.Entries != 3 {
+		t.Errorf("Bad Exit: unexpected status %+v", status)
+	}
+	var members []api.Member
+	getJSON(t, web.URL+api.MEMBERS, http.StatusOK, &members)
+	if len(members) != 1 || members[0].Addr != "127.0.0.1:12509" {
+		t.Errorf("Bad Exit: expected the client as the only member, got %+v", members)
+	}
+}
+
+// getJSON GETs url, expecting code, and decodes the body into v unless it is nil
+func getJSON(t *testing.T, url string, code int, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Bad Exit: GET %s produced err: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != code {
+		t.Fatalf("Bad Exit: expected %d from GET %s, got %d", code, url, resp.StatusCode)
+	}
+	if v != nil {
+		if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("Bad Exit: GET %s produced err: %v", url, err)
+		}
+	}
+}
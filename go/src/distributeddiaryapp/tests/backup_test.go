@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"consensuslib/paxosnode/backup"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "journaltest.log")
+	os.Remove(path)
+	defer os.Remove(path)
+	j := backup.NewJournal(path)
+	for _, round := range []int{0, 1} {
+		if err := j.Append(map[string]int{"round": round}); err != nil {
+			t.Fatalf("Bad Exit: unable to append: %v", err)
+		}
+	}
+	// every append is on disk before the journal is closed
+	var rounds []int
+	read := func(line []byte) error {
+		var v map[string]int
+		err := json.Unmarshal(line, &v)
+		rounds = append(rounds, v["round"])
+		return err
+	}
+	if err := backup.ReadJSONLines(path, read); err != nil || len(rounds) != 2 {
+		t.Fatalf("Bad Exit: expected 2 lines before closing, got %v: %v", rounds, err)
+	}
+
+	if err := j.Close(); err != nil {
+		t.Fatalf("Bad Exit: unable to close: %v", err)
+	}
+	if err := j.Append(map[string]int{"round": 2}); err != nil {
+		t.Fatalf("Bad Exit: unable to append once closed: %v", err)
+	}
+	j.Close()
+	rounds = nil
+	if err := backup.ReadJSONLines(path, read); err != nil || len(rounds) != 3 || rounds[2] != 2 {
+		t.Errorf("Bad Exit: expected the append after closing to follow the others, got %v: %v", rounds, err)
+	}
+
+	// replacing the file, e.g. with a log learned from neighbours, starts it over
+	if err := j.Replace([]interface{}{map[string]int{"round": 5}}); err != nil {
+		t.Fatalf("Bad Exit: unable to replace: %v", err)
+	}
+	j.Append(map[string]int{"round": 6})
+	j.Close()
+	rounds = nil
+	if err := backup.ReadJSONLines(path, read); err != nil || len(rounds) != 2 || rounds[0] != 5 || rounds[1] != 6 {
+		t.Errorf("Bad Exit: expected the replaced line and the one appended after it, got %v: %v", rounds, err)
+	}
+}
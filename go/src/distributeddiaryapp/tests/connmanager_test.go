@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"consensuslib/paxosnode/connmanager"
+	"filelogger/logger"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+// Echo is a stand-in for a neighbour's RPC service
+type Echo struct{}
+
+func (e *Echo) Say(s string, r *string) error {
+	*r = s
+	return nil
+}
+
+// startPeer serves Echo at addr, until stopped with the returned func
+func startPeer(t *testing.T, addr string) (stop func()) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to start peer at %s: %v", addr, err)
+	}
+	server := rpc.NewServer()
+	server.Register(&Echo{})
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go server.ServeConn(conn)
+		}
+	}()
+	return func() {
+		listener.Close()
+		for len(conns) > 0 {
+			(<-conns).Close()
+		}
+	}
+}
+
+func newTestManager(attempts int) *connmanager.Manager {
+	dial := func(addr string) (*rpc.Client, error) { return rpc.Dial("tcp", addr) }
+	handshake := func(addr string, client *rpc.Client) error {
+		var r string
+		return client.Call("Echo.Say", "hello", &r)
+	}
+	m := connmanager.NewManager(dial, handshake, logger.NewDiscardLogger("connmanager"))
+	m.GiveUpAfter(attempts)
+	return m
+}
+
+// waitForState of the neighbour at addr, "" for forgotten
+func waitForState(m *connmanager.Manager, addr string, state connmanager.ConnState, within time.Duration) bool {
+	for deadline := time.Now().Add(within); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		var current connmanager.ConnState
+		for _, s := range m.Status() {
+			if s.Addr == addr {
+				current = s.State
+			}
+		}
+		if current == state {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNeighbourReconnects(t *testing.T) {
+	addr := "127.0.0.1:12520"
+	stop := startPeer(t, addr)
+	m := newTestManager(connmanager.MAXATTEMPTS)
+	defer m.Close()
+	client, err := m.Dial(addr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestNeighbourReconnects\" produced err: %v", err)
+	}
+	m.Add(addr, client)
+
+	stop()
+	m.Disconnect(addr, "killed")
+	if _, ok := m.Connected()[addr]; ok {
+		t.Fatalf("Bad Exit: expected %s to be out of the rounds once lost", addr)
+	}
+	time.Sleep(500 * time.Millisecond)
+	stop = startPeer(t, addr)
+	defer stop()
+	if !waitForState(m, addr, connmanager.Connected, 5*time.Second) {
+		t.Fatalf("Bad Exit: expected %s to be reconnected once back, got %v", addr, m.Status())
+	}
+	var r string
+	if err = m.Connected()[addr].Call("Echo.Say", "again", &r); err != nil || r != "again" {
+		t.Errorf("Bad Exit: expected the new connection to %s to work, got %q, %v", addr, r, err)
+	}
+}
+
+func TestDeadNeighbourGivenUp(t *testing.T) {
+	addr := "127.0.0.1:12521"
+	stop := startPeer(t, addr)
+	m := newTestManager(2)
+	defer m.Close()
+	client, err := m.Dial(addr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDeadNeighbourGivenUp\" produced err: %v", err)
+	}
+	m.Add(addr, client)
+
+	stop()
+	m.Disconnect(addr, "killed")
+	if !waitForState(m, addr, connmanager.Connecting, time.Second) {
+		t.Fatalf("Bad Exit: expected %s to be redialed first, got %v", addr, m.Status())
+	}
+	// two redials, after about 250ms and 500ms of backoff
+	if !waitForState(m, addr, "", 3*time.Second) {
+		t.Fatalf("Bad Exit: expected %s to be given up on, got %v", addr, m.Status())
+	}
+}
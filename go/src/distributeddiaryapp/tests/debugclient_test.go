@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"consensuslib"
+	"distributeddiaryapp/tests/util"
+	"paxostracker/breakpoint"
+	"testing"
+	"time"
+)
+
+func TestDebugClient(t *testing.T) {
+	serverAddr := "127.0.0.1:12530"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	client0, err := util.SetupClient(serverAddr, "127.0.0.1:12531")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	client0.EnableDebugControl()
+	_, err = util.SetupClient(serverAddr, "127.0.0.1:12532")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+
+	// debug control is off unless enabled
+	closed, err := consensuslib.DialDebug("127.0.0.1:12532", nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	if _, err = closed.Break(breakpoint.Breakpoint{Stage: breakpoint.Prepare}); err == nil {
+		t.Errorf("Bad Exit: expected a node without debug control to refuse breakpoints")
+	}
+	closed.Close()
+	debug, err := consensuslib.DialDebug("127.0.0.1:12531", nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	defer debug.Close()
+
+	// arm two breakpoints, and disarm one
+	prepare, err := debug.Break(breakpoint.Breakpoint{Stage: breakpoint.Prepare})
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	learn, err := debug.Break(breakpoint.Breakpoint{Stage: breakpoint.Learn, ValueContains: "never written"})
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	if armed, _ := debug.Breakpoints(); len(armed) != 2 || armed[0].ID != prepare || armed[1].ID != learn {
+		t.Fatalf("Bad Exit: armed breakpoints %v, expected %d and %d", armed, prepare, learn)
+	}
+	if err = debug.Delete(learn); err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	if armed, _ := debug.Breakpoints(); len(armed) != 1 || armed[0].ID != prepare {
+		t.Fatalf("Bad Exit: armed breakpoints %v after deleting %d, expected only %d", armed, learn, prepare)
+	}
+	if err = debug.Delete(learn); err == nil {
+		t.Errorf("Bad Exit: expected deleting breakpoint %d twice to fail", learn)
+	}
+	if _, err = debug.Break(breakpoint.Breakpoint{Stage: "nowhere"}); err == nil {
+		t.Errorf("Bad Exit: expected a breakpoint at an unknown stage to be refused")
+	}
+
+	go client0.Write("debugged")
+	time.Sleep(50 * time.Millisecond)
+	if paused, _ := debug.Paused(); len(paused) != 1 || paused[0].Stage != breakpoint.Prepare || paused[0].Value != "debugged" {
+		t.Fatalf("Bad Exit: paused at %v, expected to pause before preparing 'debugged'", paused)
+	}
+
+	// a step stops at the neighbour's promise
+	next, err := debug.Step()
+	if err != nil || len(next) == 0 {
+		t.Fatalf("Bad Exit: stepped to %v, %v, expected the next stages", next, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if paused, _ := debug.Paused(); len(paused) != 1 || paused[0].Stage != breakpoint.Reply || paused[0].Peer != "127.0.0.1:12532" {
+		t.Fatalf("Bad Exit: paused at %v after a step, expected to pause at the reply of 127.0.0.1:12532", paused)
+	}
+
+	// and continuing runs the round to the end
+	if err = debug.Continue(); err != nil {
+		t.Fatalf("Bad Exit: \"TestDebugClient\" produced err: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if paused, _ := debug.Paused(); len(paused) != 0 {
+		t.Fatalf("Bad Exit: still paused at %v after continuing", paused)
+	}
+	if value, _ := client0.Read(); value != "debugged\n" {
+		t.Errorf("Bad Exit: Read Data '%s' after continuing, expected 'debugged'", value)
+	}
+	if err = debug.Continue(); err == nil {
+		t.Errorf("Bad Exit: expected continuing a node that is not paused to fail")
+	}
+}
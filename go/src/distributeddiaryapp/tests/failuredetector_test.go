@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"consensuslib/paxosnode"
+	"consensuslib/paxosnode/failuredetector"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func TestPhiAccrual(t *testing.T) {
+	now := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	d := failuredetector.NewDetector(8, 10, 100*time.Millisecond, 10*time.Millisecond, 0)
+	d.SetClock(func() time.Time { return now })
+	peer := "127.0.0.1:12523"
+
+	if phi := d.Phi(peer); phi != 0 || d.Suspect(peer) {
+		t.Fatalf("Bad Exit: expected a peer never heard from to have a phi of 0, got %.2f", phi)
+	}
+	// a heartbeat every 100ms
+	for i := 0; i < 10; i++ {
+		now = now.Add(100 * time.Millisecond)
+		d.Heartbeat(peer)
+	}
+	lastBeat := now
+
+	last := -1.0
+	for _, silence := range []struct {
+		after   time.Duration
+		suspect bool
+	}{
+		{0, false},
+		{100 * time.Millisecond, false}, // on time, phi is -log10(1/2)
+		{130 * time.Millisecond, false}, // three deviations late
+		{160 * time.Millisecond, true},  // six deviations late
+		{time.Second, true},
+	} {
+		now = lastBeat.Add(silence.after)
+		phi := d.Phi(peer)
+		if phi < last {
+			t.Errorf("Bad Exit: expected phi to grow with the silence, got %.2f after %v, down from %.2f", phi, silence.after, last)
+		}
+		if d.Suspect(peer) != silence.suspect {
+			t.Errorf("Bad Exit: expected suspect to be %v after %v of silence, phi is %.2f", silence.suspect, silence.after, phi)
+		}
+		last = phi
+	}
+	now = lastBeat.Add(100 * time.Millisecond)
+	if phi := d.Phi(peer); phi < 0.29 || phi > 0.31 {
+		t.Errorf("Bad Exit: expected a peer silent for its mean interval to have a phi of 0.30, got %.2f", phi)
+	}
+
+	// a heartbeat clears the suspicion, and a removed peer is forgotten
+	now = now.Add(time.Second)
+	d.Heartbeat(peer)
+	if d.Suspect(peer) {
+		t.Errorf("Bad Exit: expected a heartbeat to clear the suspicion, phi is %.2f", d.Phi(peer))
+	}
+	d.Remove(peer)
+	now = now.Add(time.Hour)
+	if phi := d.Phi(peer); phi != 0 {
+		t.Errorf("Bad Exit: expected a removed peer to have a phi of 0, got %.2f", phi)
+	}
+}
+
+func TestUnmountTwice(t *testing.T) {
+	pn, err := paxosnode.NewPaxosNode("127.0.0.1:12524", nil, nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestUnmountTwice\" produced err: %v", err)
+	}
+	pn.UnmountPaxosNode()
+	// e.g. a replay unmounting the node its caller unmounts too
+	pn.UnmountPaxosNode()
+}
+
+func TestPingFromNonNeighbour(t *testing.T) {
+	stop := startPeer(t, "127.0.0.1:12539")
+	defer stop()
+	pn, err := paxosnode.NewPaxosNode("127.0.0.1:12538", nil, nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestPingFromNonNeighbour\" produced err: %v", err)
+	}
+	defer pn.UnmountPaxosNode()
+	wrapper, err := paxosnode.NewPaxosNodeRPCWrapper(pn)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestPingFromNonNeighbour\" produced err: %v", err)
+	}
+	now := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	pn.Detector.SetClock(func() time.Time { return now })
+	neighbour, stranger := "127.0.0.1:12539", "127.0.0.1:12540"
+	client, err := rpc.Dial("tcp", neighbour)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestPingFromNonNeighbour\" produced err: %v", err)
+	}
+	pn.Conns.Add(neighbour, client)
+
+	var alive bool
+	for _, from := range []string{neighbour, stranger} {
+		if err = wrapper.Ping(from, &alive); err != nil || !alive {
+			t.Fatalf("Bad Exit: expected a ping from %s to be answered, got %v, err %v", from, alive, err)
+		}
+	}
+	now = now.Add(time.Hour)
+	if !pn.Detector.Suspect(neighbour) {
+		t.Errorf("Bad Exit: expected a ping from a neighbour to be recorded, phi is %.2f", pn.Detector.Phi(neighbour))
+	}
+	if phi := pn.Detector.Phi(stranger); phi != 0 {
+		t.Errorf("Bad Exit: expected a ping from a non-neighbour to be ignored, phi is %.2f", phi)
+	}
+
+	// an evicted neighbour is forgotten, and its pings ignored until it rejoins
+	pn.RemoveFailedNeighbour(neighbour)
+	if err = wrapper.Ping(neighbour, &alive); err != nil || !alive {
+		t.Fatalf("Bad Exit: expected a ping from an evicted neighbour to be answered, got %v, err %v", alive, err)
+	}
+	now = now.Add(time.Hour)
+	if phi := pn.Detector.Phi(neighbour); phi != 0 {
+		t.Errorf("Bad Exit: expected an evicted neighbour to be forgotten, phi is %.2f", phi)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"consensuslib/errors"
+	"consensuslib/paxosnode/faults"
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Counter counts the calls a peer handles
+type Counter struct {
+	sync.Mutex
+	calls int
+}
+
+func (c *Counter) Inc(by int, total *int) error {
+	c.Lock()
+	defer c.Unlock()
+	c.calls += by
+	*total = c.calls
+	return nil
+}
+
+func (c *Counter) count() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.calls
+}
+
+// startCounter serves a Counter at addr, returning it and a client to it
+func startCounter(t *testing.T, addr string) (*Counter, *rpc.Client, func()) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to start peer at %s: %v", addr, err)
+	}
+	counter := &Counter{}
+	server := rpc.NewServer()
+	server.Register(counter)
+	go server.Accept(listener)
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to dial peer at %s: %v", addr, err)
+	}
+	return counter, client, func() {
+		client.Close()
+		listener.Close()
+	}
+}
+
+func TestFaultRules(t *testing.T) {
+	addr := "127.0.0.1:12522"
+	counter, client, stop := startCounter(t, addr)
+	defer stop()
+	timeout := 300 * time.Millisecond
+	in := faults.NewInjector()
+	in.SetTimeout(timeout)
+
+	// calls the counter, returning how long it took, the total it replied with and how many calls it handled
+	call := func(rule ...string) (time.Duration, int, int, error) {
+		in.Heal(nil)
+		r, err := faults.Parse(append([]string{addr}, rule...))
+		if err != nil {
+			t.Fatalf("Bad Exit: unable to parse rule %v: %v", rule, err)
+		}
+		in.Set(r)
+		before := counter.count()
+		total := 0
+		start := time.Now()
+		err = in.Call(addr, client, "Counter.Inc", 1, &total)
+		took := time.Since(start)
+		// a lost reply or duplicate is handled after the caller hears back
+		time.Sleep(50 * time.Millisecond)
+		return took, total, counter.count() - before, err
+	}
+
+	took, total, handled, err := call()
+	if err != nil || total != 1 || handled != 1 {
+		t.Fatalf("Bad Exit: expected an untouched call to be handled once, got total %d handled %d: %v", total, handled, err)
+	}
+
+	took, total, handled, err = call("drop", "100")
+	if _, ok := err.(errors.TimeoutError); !ok || handled != 0 || total != 0 {
+		t.Errorf("Bad Exit: expected a dropped call to time out unhandled, got total %d handled %d: %v", total, handled, err)
+	}
+	if took < timeout {
+		t.Errorf("Bad Exit: expected a dropped call to take the timeout, %v, took %v", timeout, took)
+	}
+
+	took, total, handled, err = call("dropreply", "100")
+	if _, ok := err.(errors.TimeoutError); !ok || handled != 1 || total != 0 {
+		t.Errorf("Bad Exit: expected a call with its reply dropped to be handled and time out, got total %d handled %d: %v", total, handled, err)
+	}
+	if took < timeout {
+		t.Errorf("Bad Exit: expected a call with its reply dropped to take the timeout, %v, took %v", timeout, took)
+	}
+
+	took, total, handled, err = call("delay", "100")
+	if err != nil || handled != 1 || total == 0 {
+		t.Errorf("Bad Exit: expected a delayed call to be handled once, got total %d handled %d: %v", total, handled, err)
+	}
+	if took < 100*time.Millisecond {
+		t.Errorf("Bad Exit: expected a call delayed by 100ms to take at least that, took %v", took)
+	}
+
+	took, total, handled, err = call("duplicate")
+	if err != nil || handled != 2 {
+		t.Errorf("Bad Exit: expected a duplicated call to be handled twice, got handled %d: %v", handled, err)
+	}
+
+	took, total, handled, err = call("partition")
+	if _, ok := err.(errors.TimeoutError); !ok || handled != 0 {
+		t.Errorf("Bad Exit: expected a call across a partition to time out unhandled, got handled %d: %v", handled, err)
+	}
+
+	// a rule for any peer applies to a peer without its own, and healing it lets calls through again
+	in.Heal(nil)
+	in.Set(faults.Rule{Peer: faults.ANYPEER, Partitioned: true})
+	if err = in.Call(addr, client, "Counter.Inc", 1, &total); err == nil {
+		t.Errorf("Bad Exit: expected a partition from every peer to cover %s", addr)
+	}
+	in.Heal([]string{faults.ANYPEER})
+	if err = in.Call(addr, client, "Counter.Inc", 1, &total); err != nil {
+		t.Errorf("Bad Exit: expected a call to go through once healed, got %v", err)
+	}
+}
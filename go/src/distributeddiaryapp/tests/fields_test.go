@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"filelogger/level"
+	"filelogger/logger"
+	"filelogger/state"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFieldsRendering(t *testing.T) {
+	l, err := logger.NewFileLogger("fieldstest", state.QUIET)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create the logger: %v", err)
+	}
+	defer l.Exit()
+	ring := logger.NewRingSink(10)
+	l.AddSink(ring, level.DEBUG)
+
+	entry := l.With(logger.Fields{logger.ROUND: 3, logger.NODE: ":2001"})
+	entry.With(logger.Fields{logger.ROUND: 4, logger.PEER: ":2002"}).Infof("[test] %s", "promised")
+	entry.Debug("[test] prepared")
+	records := ring.Records()
+	if len(records) != 2 {
+		t.Fatalf("Bad Exit: expected 2 records, got %v", records)
+	}
+	if s := records[0].String(); s != "| Info    | [test] promised | node=:2001 peer=:2002 round=4" {
+		t.Errorf("Bad Exit: expected the fields after the message sorted by key, with the later round, got %q", s)
+	}
+	// With copies the entry, leaving the original's fields as they were
+	if s := records[1].Fields.String(); s != "node=:2001 round=3" {
+		t.Errorf("Bad Exit: expected the original entry to keep its fields, got %q", s)
+	}
+	if s := (logger.Record{Level: level.ERROR, Msg: "[test] bare"}).String(); s != "| Error   | [test] bare" {
+		t.Errorf("Bad Exit: expected a record without fields to end at its message, got %q", s)
+	}
+}
+
+func TestJSONLog(t *testing.T) {
+	// named for this run only, as the files of earlier runs stay in logs/
+	name := fmt.Sprintf("jsontest%d", time.Now().UnixNano())
+	l, err := logger.NewFileLogger(name, state.QUIET)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create the logger: %v", err)
+	}
+	if err = l.EnableJSON(); err != nil {
+		t.Fatalf("Bad Exit: unable to enable the JSON log: %v", err)
+	}
+	l.With(logger.Fields{logger.NODE: ":2001", logger.ROUND: 3}).Warning("[test] with fields")
+	l.Info("[test] without")
+	l.Exit()
+
+	files, _ := filepath.Glob("logs/" + name + "*.jsonl")
+	if len(files) != 1 {
+		t.Fatalf("Bad Exit: expected one JSON log, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to open the JSON log: %v", err)
+	}
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Bad Exit: expected a JSON object per line, got %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Bad Exit: expected 2 lines, got %v", lines)
+	}
+	first := lines[0]
+	if first["msg"] != "[test] with fields" || first["level"] != level.WARNING.Name() || first["logger"] != name ||
+		first["node"] != ":2001" || first["round"] != float64(3) || first["time"] == nil {
+		t.Errorf("Bad Exit: expected the entry's keys and its fields, got %v", first)
+	}
+	if len(lines[1]) != 4 || lines[1]["msg"] != "[test] without" {
+		t.Errorf("Bad Exit: expected only time, logger, level and msg without fields, got %v", lines[1])
+	}
+}
+
+func TestNilLoggerWarnsOnce(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	var l *logger.Logger
+	l.Info("[test] first")
+	l.With(logger.Fields{logger.NODE: ":2001"}).Infof("[test] %s", "second")
+	os.Stderr = stderr
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+
+	if n := strings.Count(string(out), "LOGGING ERROR"); n > 1 {
+		t.Errorf("Bad Exit: expected the uninitialised logger warning at most once, got it %d times in %q", n, out)
+	}
+	if !strings.Contains(string(out), "[test] first") || !strings.Contains(string(out), "[test] second node=:2001") {
+		t.Errorf("Bad Exit: expected both entries on stderr, got %q", out)
+	}
+}
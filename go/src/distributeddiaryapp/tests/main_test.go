@@ -0,0 +1,13 @@
+package tests
+
+import (
+	"consensuslib/paxosnode/backup"
+	"os"
+	"testing"
+)
+
+// TestMain starts every run without the files of earlier ones, which nodes would restore their logs from
+func TestMain(m *testing.M) {
+	os.RemoveAll(backup.DIR)
+	os.Exit(m.Run())
+}
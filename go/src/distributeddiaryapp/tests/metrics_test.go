@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"bytes"
+	"distributeddiaryapp/tests/util"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	serverAddr := "127.0.0.1:12505"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestMetrics\" produced err: %v", err)
+	}
+	client, err := util.SetupClient(serverAddr, "127.0.0.1:12506")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestMetrics\" produced err: %v", err)
+	}
+	err = client.Write("counted")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestMetrics\" produced err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	var buf bytes.Buffer
+	err = client.Metrics().Write(&buf)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestMetrics\" produced err: %v", err)
+	}
+	for _, line := range []string{
+		"paxos_proposals_started_total 1",
+		"paxos_proposals_committed_total 1",
+		"paxos_prepare_duration_seconds_count 1",
+		"paxos_accept_duration_seconds_count 1",
+		"paxos_learned_log_length 1",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Bad Exit: expected %q in the metrics, got\n%s", line, buf.String())
+		}
+	}
+
+	addr, err := client.ServeMetrics("127.0.0.1:12507")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestMetrics\" produced err: %v", err)
+	}
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestMetrics\" produced err: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestMetrics\" produced err: %v", err)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") || !strings.Contains(string(body), "# TYPE paxos_nacks_total counter\n") {
+		t.Errorf("Bad Exit: expected the metrics as text, got %s\n%s", resp.Header.Get("Content-Type"), body)
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"consensuslib"
+	"consensuslib/security"
+	"filelogger/vclock"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+// listNodes asks the server for its nodes, by address
+func listNodes(t *testing.T, server *rpc.Client) map[string]consensuslib.NodeStatus {
+	var nodes []consensuslib.NodeStatus
+	if err := server.Call("Server.ListNodes", "placeholder", &nodes); err != nil {
+		t.Fatalf("Bad Exit: unable to list nodes: %v", err)
+	}
+	byAddr := make(map[string]consensuslib.NodeStatus)
+	for i, n := range nodes {
+		if i > 0 && nodes[i-1].Address >= n.Address {
+			t.Errorf("Bad Exit: expected nodes to be listed by address, got %v", nodes)
+		}
+		byAddr[n.Address] = n
+	}
+	return byAddr
+}
+
+func TestHeartBeatStates(t *testing.T) {
+	serverAddr := "127.0.0.1:12525"
+	server, err := consensuslib.NewServer(serverAddr, nil, nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to start the server: %v", err)
+	}
+	if err = server.SetHeartBeatConfig(consensuslib.HeartBeatConfig{SuspectAfter: 200 * time.Millisecond, DeadAfter: 500 * time.Millisecond}); err != nil {
+		t.Fatalf("Bad Exit: unable to set the heartbeat config: %v", err)
+	}
+	go server.Serve()
+	conn, err := net.Dial("tcp", serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to dial the server: %v", err)
+	}
+	client := vclock.NewClient(conn, nil)
+	defer client.Close()
+
+	quiet, beating := "127.0.0.1:12526", "127.0.0.1:12527"
+	var neighbours []string
+	for _, addr := range []string{quiet, beating} {
+		if err = client.Call("Server.Register", security.JoinRequest{Addr: addr}, &neighbours); err != nil {
+			t.Fatalf("Bad Exit: unable to register %s: %v", addr, err)
+		}
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		var ignored bool
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(50 * time.Millisecond):
+				client.Call("Server.HeartBeat", beating, &ignored)
+			}
+		}
+	}()
+
+	nodes := listNodes(t, client)
+	if len(nodes) != 2 || nodes[quiet].State != consensuslib.Alive || nodes[beating].State != consensuslib.Alive {
+		t.Fatalf("Bad Exit: expected both nodes to be alive once registered, got %v", nodes)
+	}
+	registered := nodes[quiet].LastSeen
+
+	time.Sleep(300 * time.Millisecond)
+	nodes = listNodes(t, client)
+	if nodes[quiet].State != consensuslib.Suspected || nodes[beating].State != consensuslib.Alive {
+		t.Fatalf("Bad Exit: expected only the quiet node to be suspected, got %v", nodes)
+	}
+	if !nodes[quiet].LastSeen.Equal(registered) || !nodes[beating].LastSeen.After(registered) {
+		t.Errorf("Bad Exit: expected the nodes to be last seen at their last heartbeat, got %v", nodes)
+	}
+
+	// a heartbeat clears the suspicion
+	var ignored bool
+	if err = client.Call("Server.HeartBeat", quiet, &ignored); err != nil {
+		t.Fatalf("Bad Exit: unable to send a heartbeat for %s: %v", quiet, err)
+	}
+	if nodes = listNodes(t, client); nodes[quiet].State != consensuslib.Alive {
+		t.Fatalf("Bad Exit: expected the quiet node to be alive again after a heartbeat, got %v", nodes)
+	}
+
+	// and silence past DeadAfter removes the node
+	time.Sleep(700 * time.Millisecond)
+	nodes = listNodes(t, client)
+	if _, ok := nodes[quiet]; ok || len(nodes) != 1 || nodes[beating].State != consensuslib.Alive {
+		t.Fatalf("Bad Exit: expected only the beating node to be left, got %v", nodes)
+	}
+	if err = client.Call("Server.HeartBeat", quiet, &ignored); err == nil {
+		t.Errorf("Bad Exit: expected a heartbeat from a dead node to be refused")
+	}
+}
+
+func TestHeartBeatConfigChange(t *testing.T) {
+	serverAddr := "127.0.0.1:12536"
+	server, err := consensuslib.NewServer(serverAddr, nil, nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to start the server: %v", err)
+	}
+	go server.Serve()
+	conn, err := net.Dial("tcp", serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to dial the server: %v", err)
+	}
+	client := vclock.NewClient(conn, nil)
+	defer client.Close()
+	addr := "127.0.0.1:12537"
+	var neighbours []string
+	if err = client.Call("Server.Register", security.JoinRequest{Addr: addr}, &neighbours); err != nil {
+		t.Fatalf("Bad Exit: unable to register %s: %v", addr, err)
+	}
+
+	// registered under the default config, judged by the shorter one from its change on
+	if err = server.SetHeartBeatConfig(consensuslib.HeartBeatConfig{SuspectAfter: 100 * time.Millisecond, DeadAfter: 300 * time.Millisecond}); err != nil {
+		t.Fatalf("Bad Exit: unable to set the heartbeat config: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if nodes := listNodes(t, client); nodes[addr].State != consensuslib.Suspected {
+		t.Fatalf("Bad Exit: expected %s to be suspected by the new config, got %v", addr, nodes)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if nodes := listNodes(t, client); len(nodes) != 0 {
+		t.Fatalf("Bad Exit: expected %s to be dead by the new config, got %v", addr, nodes)
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"consensuslib"
+	"distributeddiaryapp/tests/util"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadRange(t *testing.T) {
+	serverAddr := "127.0.0.1:12513"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestReadRange\" produced err: %v", err)
+	}
+	writer, err := util.SetupClient(serverAddr, "127.0.0.1:12514")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestReadRange\" produced err: %v", err)
+	}
+	reader, err := util.SetupClient(serverAddr, "127.0.0.1:12515")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestReadRange\" produced err: %v", err)
+	}
+	values := []string{"zero", "one", "two", "three", "four"}
+	for _, value := range values {
+		err = writer.Write(value)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestReadRange\" produced err: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := writer.Len(); n != len(values) {
+		t.Fatalf("Bad Exit: expected %d entries, got %d", len(values), n)
+	}
+
+	entry := func(slot int) consensuslib.Entry {
+		return consensuslib.Entry{Slot: slot, Value: values[slot], Proposer: "127.0.0.1:12514"}
+	}
+	for _, c := range []struct {
+		from, to int
+		expected []consensuslib.Entry
+	}{
+		{1, 3, []consensuslib.Entry{entry(1), entry(2)}},
+		{3, 100, []consensuslib.Entry{entry(3), entry(4)}},
+		{5, 10, []consensuslib.Entry{}},
+	} {
+		entries, err := writer.ReadRange(c.from, c.to)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestReadRange\" produced err: %v", err)
+		}
+		if !reflect.DeepEqual(entries, c.expected) {
+			t.Errorf("Bad Exit: expected %v in [%d, %d), got %v", c.expected, c.from, c.to, entries)
+		}
+	}
+	if _, err = writer.ReadRange(4, 2); err == nil {
+		t.Errorf("Bad Exit: expected an error reading [4, 2)")
+	}
+
+	entries, err := reader.ReadRangeFrom("127.0.0.1:12514", 2, 4)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestReadRange\" produced err: %v", err)
+	}
+	if expected := []consensuslib.Entry{entry(2), entry(3)}; !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Bad Exit: expected %v from the writer, got %v", expected, entries)
+	}
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"consensuslib/paxosnode"
+	"testing"
+	"time"
+)
+
+func TestRestartAlone(t *testing.T) {
+	addr := "127.0.0.1:12535"
+	pn, err := paxosnode.NewPaxosNode(addr, nil, nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestRestartAlone\" produced err: %v", err)
+	}
+	for _, value := range []string{"before the restart", "and another"} {
+		if _, err = pn.WriteToPaxosNode(value, value, paxosnode.TTL); err != nil {
+			t.Fatalf("Bad Exit: \"TestRestartAlone\" produced err: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	pn.UnmountPaxosNode()
+
+	// the node comes back without any neighbours to learn its log from
+	pn, err = paxosnode.NewPaxosNode(addr, nil, nil)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestRestartAlone\" produced err: %v", err)
+	}
+	defer pn.UnmountPaxosNode()
+	if log := pn.Learner.Log; len(log) != 2 || log[0].Value != "before the restart" || log[1].Value != "and another" {
+		t.Fatalf("Bad Exit: expected the restarted node to restore its log, got %v", log)
+	}
+	if hits := pn.Learner.Index.Search("restart"); len(hits) != 1 || hits[0].Slot != 0 {
+		t.Errorf("Bad Exit: expected the restored log to be searchable, got %v", hits)
+	}
+
+	// and carries on after it
+	if _, err = pn.WriteToPaxosNode("after the restart", "after the restart", paxosnode.TTL); err != nil {
+		t.Fatalf("Bad Exit: \"TestRestartAlone\" produced err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if log := pn.Learner.Log; len(log) != 3 || log[2].Value != "after the restart" {
+		t.Errorf("Bad Exit: expected a write after the restart to go in slot 2, got %v", log)
+	}
+	if hits := pn.Learner.Index.Search("restart"); len(hits) != 2 || hits[1].Slot != 2 {
+		t.Errorf("Bad Exit: expected both values about the restart to be found, got %v", hits)
+	}
+}
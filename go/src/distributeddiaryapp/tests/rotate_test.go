@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"compress/gzip"
+	"filelogger/rotate"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// left by an earlier run, the oldest file of the log
+	err = ioutil.WriteFile(filepath.Join(dir, "old.log"), []byte("old\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "new.log")
+	w, err := rotate.NewWriter(path, filepath.Join(dir, "*.log*"), rotate.Config{MaxSize: 10, MaxFiles: 3, Compress: true, Async: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = w.Write([]byte(line)); err != nil {
+			t.Fatalf("Bad Exit: write failed: %s", err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Bad Exit: close failed: %s", err)
+	}
+	if _, err = w.Write([]byte("late\n")); err == nil {
+		t.Errorf("Bad Exit: expected writing after close to fail")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 3 {
+		t.Fatalf("Bad Exit: expected the 3 newest files to be kept, got %v", files)
+	}
+	if current, _ := ioutil.ReadFile(path); string(current) != "fourth\n" {
+		t.Errorf("Bad Exit: expected the last write in %s, got %q", path, current)
+	}
+	f, err := os.Open(path + ".3.gz")
+	if err != nil {
+		t.Fatalf("Bad Exit: expected the last rotated file to be gzipped: %s", err)
+	}
+	defer f.Close()
+	zipped, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated, _ := ioutil.ReadAll(zipped); !strings.Contains(string(rotated), "third") {
+		t.Errorf("Bad Exit: expected the third write in the last rotated file, got %q", rotated)
+	}
+}
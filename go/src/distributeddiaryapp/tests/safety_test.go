@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"consensuslib/message"
+	"consensuslib/paxosnode/acceptor"
+	"consensuslib/paxosnode/safety"
+	"testing"
+)
+
+func TestSafetyCheck(t *testing.T) {
+	proposed := message.NewMessage(1, "a", message.ACCEPT, "proposed", "127.0.0.1:1", 0, 3)
+	other := message.NewMessage(2, "b", message.ACCEPT, "other", "127.0.0.1:2", 0, 3)
+	promise := message.NewMessage(3, "c", message.PREPARE, "", "127.0.0.1:2", 0, 3)
+	nodes := []*safety.Node{
+		{ID: ":1", Learned: []message.Message{proposed}, Proposals: []message.Message{proposed}},
+		{ID: ":2", Learned: []message.Message{proposed}, History: []acceptor.Decision{
+			{Request: promise, Promised: true},
+			{Request: proposed, Accepted: true},
+		}},
+	}
+	if violations := safety.Check(nodes); len(violations) != 1 || violations[0].Property != safety.PROMISE {
+		t.Errorf("Bad Exit: expected only a promise violation, got %v", violations)
+	}
+
+	nodes = append(nodes, &safety.Node{ID: ":3", Learned: []message.Message{other}})
+	violations := safety.Check(nodes)
+	if len(violations) != 3 {
+		t.Fatalf("Bad Exit: expected agreement, promise and validity violations, got %v", violations)
+	}
+	if v := violations[0]; v.Property != safety.AGREEMENT || v.Slot != 0 || len(v.Nodes) != 3 {
+		t.Errorf("Bad Exit: expected slot 0 to be learned differently by all nodes, got %v", v)
+	}
+	if v := violations[2]; v.Property != safety.VALIDITY || len(v.Nodes) != 1 || v.Nodes[0] != ":3" {
+		t.Errorf("Bad Exit: expected :3 to have learned a value never proposed, got %v", v)
+	}
+}
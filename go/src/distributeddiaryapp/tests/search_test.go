@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"consensuslib"
+	"distributeddiaryapp/tests/util"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	serverAddr := "127.0.0.1:12516"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSearch\" produced err: %v", err)
+	}
+	writer, err := util.SetupClient(serverAddr, "127.0.0.1:12517")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSearch\" produced err: %v", err)
+	}
+	for _, value := range []string{
+		"Dear diary the owl came today",
+		"nothing happened",
+		"one two three four five six seven eight nine ten owl eleven twelve",
+	} {
+		err = writer.Write(value)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestSearch\" produced err: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	expected := []consensuslib.Hit{
+		{Slot: 0, Snippet: "Dear diary the owl came today"},
+		{Slot: 2, Snippet: "...six seven eight nine ten owl eleven twelve"},
+	}
+	hits, err := writer.Search("OWL")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSearch\" produced err: %v", err)
+	}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Errorf("Bad Exit: expected %v, got %v", expected, hits)
+	}
+	hits, err = writer.Search("owl diary")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSearch\" produced err: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Slot != 0 {
+		t.Errorf("Bad Exit: expected slot 0 for every term, got %v", hits)
+	}
+	if _, err = writer.Search(" "); err == nil {
+		t.Errorf("Bad Exit: expected an error searching without terms")
+	}
+
+	// a node joining later indexes the log it is initialised with
+	joiner, err := util.SetupClient(serverAddr, "127.0.0.1:12518")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSearch\" produced err: %v", err)
+	}
+	hits, err = joiner.Search("owl")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSearch\" produced err: %v", err)
+	}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Errorf("Bad Exit: expected %v from the joining node, got %v", expected, hits)
+	}
+}
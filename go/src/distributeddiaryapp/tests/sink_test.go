@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"consensuslib"
+	"distributeddiaryapp/tests/util"
+	"filelogger/level"
+	"filelogger/logger"
+	"filelogger/state"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingSink(t *testing.T) {
+	l, err := logger.NewFileLogger("sinktest", state.QUIET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Exit()
+	ring := logger.NewRingSink(2)
+	l.AddSink(ring, level.WARNING)
+
+	l.Debug("[test] below the sink's level")
+	l.Warning("[test] pushed out")
+	l.Error("[test] kept")
+	l.With(logger.Fields{logger.NODE: ":1"}).Errorf("[test] kept %s", "too")
+	records := ring.Records()
+	if len(records) != 2 || records[0].Msg != "[test] kept" || records[1].Msg != "[test] kept too" {
+		t.Fatalf("Bad Exit: expected the last 2 warnings and errors, oldest first, got %v", records)
+	}
+	if records[1].Level != level.ERROR || records[1].Fields[logger.NODE] != ":1" {
+		t.Errorf("Bad Exit: expected an error with its node field, got %v", records[1])
+	}
+
+	ring.Clear()
+	l.SetLevel("[test]", level.FATAL)
+	l.Error("[test] below the component's level")
+	l.RemoveSink(ring)
+	l.Fatal("[test] after the sink was removed")
+	if records = ring.Records(); len(records) != 0 {
+		t.Errorf("Bad Exit: expected no records, got %v", records)
+	}
+}
+
+func TestLoggerPerClient(t *testing.T) {
+	serverAddr := "127.0.0.1:12495"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestLoggerPerClient\" produced err: %v", err)
+	}
+	var clients []*consensuslib.Client
+	var rings []*logger.RingSink
+	for _, addr := range []string{"127.0.0.1:12496", "127.0.0.1:12497"} {
+		log, err := util.NodeLogger("client", addr)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestLoggerPerClient\" produced err: %v", err)
+		}
+		ring := logger.NewRingSink(1000)
+		log.AddSink(ring, level.DEBUG)
+		client, err := consensuslib.NewClient(addr, addr, util.HEARTBEAT_INTERVAL, nil, log)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestLoggerPerClient\" produced err: %v", err)
+		}
+		err = client.Connect(serverAddr)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestLoggerPerClient\" produced err: %v", err)
+		}
+		clients = append(clients, client)
+		rings = append(rings, ring)
+	}
+
+	err = clients[0].Write("logged apart")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestLoggerPerClient\" produced err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for i, name := range []string{"client12496", "client12497"} {
+		records := rings[i].Records()
+		if len(records) == 0 {
+			t.Fatalf("Bad Exit: nothing logged by %s", name)
+		}
+		acceptor := false
+		for _, r := range records {
+			if r.Logger != name {
+				t.Fatalf("Bad Exit: %s got a record of %s: %v", name, r.Logger, r)
+			}
+			acceptor = acceptor || strings.HasPrefix(r.Msg, "[Acceptor]")
+		}
+		if !acceptor {
+			t.Errorf("Bad Exit: expected the acceptor of %s to log to it", name)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"consensuslib"
+	"distributeddiaryapp/tests/util"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	serverAddr := "127.0.0.1:12510"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSubscribe\" produced err: %v", err)
+	}
+	writer, err := util.SetupClient(serverAddr, "127.0.0.1:12511")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSubscribe\" produced err: %v", err)
+	}
+	follower, err := util.SetupClient(serverAddr, "127.0.0.1:12512")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSubscribe\" produced err: %v", err)
+	}
+	err = writer.Write("before")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestSubscribe\" produced err: %v", err)
+	}
+
+	entries, cancel := follower.Subscribe(0)
+	for _, value := range []string{"during", "after"} {
+		err = writer.Write(value)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestSubscribe\" produced err: %v", err)
+		}
+	}
+	for slot, value := range []string{"before", "during", "after"} {
+		expected := consensuslib.Entry{Slot: slot, Value: value, Proposer: "127.0.0.1:12511"}
+		select {
+		case e := <-entries:
+			if e != expected {
+				t.Fatalf("Bad Exit: expected %+v, got %+v", expected, e)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Bad Exit: timed out waiting for %+v", expected)
+		}
+	}
+
+	cancel()
+	select {
+	case e, ok := <-entries:
+		if ok {
+			t.Errorf("Bad Exit: expected the entries to end once cancelled, got %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Bad Exit: timed out waiting for the entries to end")
+	}
+
+	// a negative index follows from the start, rather than panicking in the subscription
+	entries, cancel = follower.Subscribe(-5)
+	defer cancel()
+	select {
+	case e := <-entries:
+		if e.Slot != 0 || e.Value != "before" {
+			t.Errorf("Bad Exit: expected slot 0 from a negative index, got %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Bad Exit: timed out waiting for slot 0 from a negative index")
+	}
+}
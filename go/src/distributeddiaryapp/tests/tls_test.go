@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"consensuslib/security"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"distributeddiaryapp/tests/util"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCA signs certificates made at test time
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "distributed diary test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert, key, pool}
+}
+
+// security returns a mutual TLS config for a node whose certificate covers ip
+func (ca *testCA) security(t *testing.T, name string, ip string) *security.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to generate key for %s: %v", name, err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP(ip)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create certificate for %s: %v", name, err)
+	}
+	return &security.Config{TLS: &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      ca.pool,
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}}
+}
+
+func TestTLSTwoClientReadWrite(t *testing.T) {
+	serverAddr := "127.0.0.1:12445"
+	ca := newTestCA(t)
+	err := util.SetupSecureServer(serverAddr, ca.security(t, "server", "127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTLSTwoClientReadWrite\" produced err: %v", err)
+	}
+	client0, err := util.SetupSecureClient(serverAddr, "127.0.0.1:12446", ca.security(t, "client0", "127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTLSTwoClientReadWrite\" produced err: %v", err)
+	}
+	client1, err := util.SetupSecureClient(serverAddr, "127.0.0.1:12447", ca.security(t, "client1", "127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTLSTwoClientReadWrite\" produced err: %v", err)
+	}
+
+	err = client0.Write("secret")
+	if err != nil {
+		t.Errorf("Bad Exit: \"TestTLSTwoClientReadWrite\" produced err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	value, err := client1.Read()
+	if err != nil {
+		t.Errorf("Bad Exit: \"TestTLSTwoClientReadWrite\" produced err: %v", err)
+	}
+	if value != "secret\n" {
+		t.Errorf("Bad Exit: Read Data '%s' for Client 1 does not match written data '%s'", value, "secret")
+	}
+}
+
+func TestTLSRejectsUntrustedClients(t *testing.T) {
+	serverAddr := "127.0.0.1:12455"
+	ca := newTestCA(t)
+	err := util.SetupSecureServer(serverAddr, ca.security(t, "server", "127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTLSRejectsUntrustedClients\" produced err: %v", err)
+	}
+	otherCA := newTestCA(t)
+
+	var tests = []struct {
+		Name      string
+		LocalAddr string
+		Sec       *security.Config
+	}{
+		{
+			Name:      "plain TCP",
+			LocalAddr: "127.0.0.1:12456",
+			Sec:       nil,
+		},
+		{
+			Name:      "certificate from another CA",
+			LocalAddr: "127.0.0.1:12457",
+			Sec:       otherCA.security(t, "intruder", "127.0.0.1"),
+		},
+		{
+			Name:      "certificate for another address",
+			LocalAddr: "127.0.0.1:12458",
+			Sec:       ca.security(t, "impostor", "10.0.0.1"),
+		},
+	}
+	for _, test := range tests {
+		_, err := util.SetupSecureClient(serverAddr, test.LocalAddr, test.Sec)
+		if err == nil {
+			t.Errorf("Bad Exit: \"TestTLSRejectsUntrustedClients(%s)\" was allowed to register", test.Name)
+		}
+	}
+}
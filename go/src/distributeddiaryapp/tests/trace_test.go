@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"consensuslib"
+	"consensuslib/paxosnode"
+	"consensuslib/paxosnode/trace"
+	"distributeddiaryapp/tests/util"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTraceReplay(t *testing.T) {
+	serverAddr := "127.0.0.1:12485"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+	}
+	dir := t.TempDir()
+	var clients []*consensuslib.Client
+	for i, addr := range []string{"127.0.0.1:12486", "127.0.0.1:12487"} {
+		log, err := util.NodeLogger("client", addr)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+		client, err := consensuslib.NewClient(addr, addr, util.HEARTBEAT_INTERVAL, nil, log)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+		err = client.RecordTrace(filepath.Join(dir, strconv.Itoa(i)+".trace"))
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+		err = client.Connect(serverAddr)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+		clients = append(clients, client)
+	}
+	for i, value := range []string{"recorded", "replayed"} {
+		err = clients[i].Write(value)
+		if err != nil {
+			t.Errorf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for i := range clients {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(i)+".trace"))
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+		events, err := trace.Read(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+		pn, divergences, err := paxosnode.Replay(events, nil)
+		if err != nil {
+			t.Fatalf("Bad Exit: \"TestTraceReplay\" produced err: %v", err)
+		}
+		for _, d := range divergences {
+			t.Errorf("Bad Exit: replay of client %d diverged at %v", i, d)
+		}
+		log, _ := pn.GetLog()
+		if len(log) != 2 || log[0].Value != "recorded" || log[1].Value != "replayed" {
+			t.Errorf("Bad Exit: replay of client %d learned %v, expected 'recorded' then 'replayed'", i, log)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"consensuslib"
+	"distributeddiaryapp/tests/util"
+	"paxostracker/breakpoint"
+	"paxostracker/state"
+	"testing"
+	"time"
+)
+
+func TestTrackerPerClient(t *testing.T) {
+	serverAddr := "127.0.0.1:12465"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTrackerPerClient\" produced err: %v", err)
+	}
+	client0, err := util.SetupClient(serverAddr, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTrackerPerClient\" produced err: %v", err)
+	}
+	client1, err := util.SetupClient(serverAddr, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestTrackerPerClient\" produced err: %v", err)
+	}
+	if client0.Tracker() == client1.Tracker() {
+		t.Fatalf("Bad Exit: both clients share one tracker")
+	}
+
+	err = client0.Write("tracked")
+	if err != nil {
+		t.Errorf("Bad Exit: \"TestTrackerPerClient\" produced err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	rounds := client0.Tracker().Rounds()
+	if len(rounds) != 1 || rounds[0].Value != "tracked" {
+		t.Fatalf("Bad Exit: writer tracked rounds %v, expected one round of 'tracked'", rounds)
+	}
+	if len(rounds[0].Promised) != 2 || len(rounds[0].Accepted) != 2 || len(rounds[0].Learned) != 1 {
+		t.Errorf("Bad Exit: writer saw votes %+v, expected both nodes to promise and accept", rounds[0].Votes)
+	}
+	// the other client only took part as an acceptor
+	rounds = client1.Tracker().Rounds()
+	if len(rounds) != 1 || rounds[0].Value != "tracked" || len(rounds[0].Learned) != 1 {
+		t.Errorf("Bad Exit: non-writer tracked rounds %v, expected to learn 'tracked'", rounds)
+	}
+	for _, client := range []*consensuslib.Client{client0, client1} {
+		if client.Tracker().State() != state.Idle {
+			t.Errorf("Bad Exit: client left in state %v", client.Tracker().State())
+		}
+	}
+
+	// either client sees the same cluster-wide timeline
+	timeline, unreachable := client1.ClusterRounds()
+	if len(unreachable) != 0 {
+		t.Errorf("Bad Exit: \"TestTrackerPerClient\" could not reach %v", unreachable)
+	}
+	if len(timeline) != 1 || len(timeline[0].Promised) != 2 || len(timeline[0].Accepted) != 2 || len(timeline[0].Learned) != 2 ||
+		len(timeline[0].Conflicts) != 0 {
+		t.Errorf("Bad Exit: cluster timeline %+v, expected one round every node voted in", timeline)
+	}
+}
+
+func TestConditionalBreakpoint(t *testing.T) {
+	serverAddr := "127.0.0.1:12475"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestConditionalBreakpoint\" produced err: %v", err)
+	}
+	client0, err := util.SetupClient(serverAddr, "127.0.0.1:12476")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestConditionalBreakpoint\" produced err: %v", err)
+	}
+	client1, err := util.SetupClient(serverAddr, "127.0.0.1:12477")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestConditionalBreakpoint\" produced err: %v", err)
+	}
+	b, err := breakpoint.Parse([]string{"learn", "value", "stop", "peer", "127.0.0.1:12476"})
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestConditionalBreakpoint\" produced err: %v", err)
+	}
+	id := client1.Tracker().Break(b)
+
+	// values not matching the breakpoint go straight through
+	client0.Write("go")
+	time.Sleep(50 * time.Millisecond)
+	if paused := client1.Tracker().Paused(); len(paused) != 0 {
+		t.Fatalf("Bad Exit: paused at %v for a value without 'stop'", paused)
+	}
+
+	client0.Write("stop here")
+	time.Sleep(50 * time.Millisecond)
+	paused := client1.Tracker().Paused()
+	if len(paused) != 1 || paused[0].Stage != breakpoint.Learn || paused[0].Value != "stop here" {
+		t.Fatalf("Bad Exit: paused at %v, expected to pause before learning 'stop here'", paused)
+	}
+	if value, _ := client1.Read(); value != "go\n" {
+		t.Errorf("Bad Exit: Read Data '%s' while paused, expected only 'go'", value)
+	}
+	if len(client1.Tracker().Breakpoints()) != 0 {
+		t.Errorf("Bad Exit: breakpoint %d still armed after firing once", id)
+	}
+
+	err = client1.Tracker().Continue()
+	if err != nil {
+		t.Errorf("Bad Exit: \"TestConditionalBreakpoint\" produced err: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if value, _ := client1.Read(); value != "go\nstop here\n" {
+		t.Errorf("Bad Exit: Read Data '%s' after continuing, expected 'go' and 'stop here'", value)
+	}
+}
+
+func TestStepReplies(t *testing.T) {
+	serverAddr := "127.0.0.1:12488"
+	err := util.SetupServer(serverAddr)
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestStepReplies\" produced err: %v", err)
+	}
+	client0, err := util.SetupClient(serverAddr, "127.0.0.1:12489")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestStepReplies\" produced err: %v", err)
+	}
+	_, err = util.SetupClient(serverAddr, "127.0.0.1:12490")
+	if err != nil {
+		t.Fatalf("Bad Exit: \"TestStepReplies\" produced err: %v", err)
+	}
+	tracker := client0.Tracker()
+	tracker.Break(breakpoint.Breakpoint{Stage: breakpoint.Prepare})
+	go client0.Write("stepped")
+
+	// the single neighbour's promise is a stop of its own, between preparing and proposing
+	for _, expected := range []breakpoint.Context{
+		{Stage: breakpoint.Prepare},
+		{Stage: breakpoint.Reply, Peer: "127.0.0.1:12490", Votes: 2, Of: 2},
+		{Stage: breakpoint.Propose},
+		{Stage: breakpoint.Notify, Peer: "127.0.0.1:12489", Votes: 1, Of: 2},
+	} {
+		time.Sleep(50 * time.Millisecond)
+		paused := tracker.Paused()
+		if len(paused) != 1 || paused[0].Stage != expected.Stage || paused[0].Votes != expected.Votes || paused[0].Of != expected.Of ||
+			(expected.Peer != "" && paused[0].Peer != expected.Peer) {
+			t.Fatalf("Bad Exit: paused at %v, expected to pause at %v", paused, expected)
+		}
+		if _, err = tracker.Step(); err != nil {
+			t.Fatalf("Bad Exit: \"TestStepReplies\" produced err: %v", err)
+		}
+	}
+	for i := 0; i < 10 && (len(tracker.Paused()) != 0 || tracker.State() != state.Idle); i++ {
+		time.Sleep(50 * time.Millisecond)
+		tracker.Step()
+	}
+	if value, _ := client0.Read(); value != "stepped\n" {
+		t.Errorf("Bad Exit: Read Data '%s' after stepping through the round, expected 'stepped'", value)
+	}
+}
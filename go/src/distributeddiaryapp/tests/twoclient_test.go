@@ -26,7 +26,7 @@ func TwoTests() []TestTwoData {
 
 func TestTwoReadOneWrite(t *testing.T) {
 	serverAddr := "127.0.0.1:12345"
-	localPort := "0"
+	localPort := "127.0.0.1:0"
 	util.SetupServer(serverAddr)
 	for _, test := range TwoTests() {
 		client0, err := util.SetupClient(serverAddr, localPort)
@@ -2,7 +2,12 @@ package util
 
 import (
 	"consensuslib"
-	"strconv"
+	"consensuslib/security"
+	"filelogger/logger"
+	"filelogger/state"
+	"fmt"
+	"net"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,9 +15,16 @@ const (
 	HEARTBEAT_INTERVAL = 1 * time.Millisecond
 )
 
-func SetupClient(serverAddr string, localPort string) (client *consensuslib.Client, err error) {
-	intPort, err := strconv.Atoi(localPort)
-	client, err = consensuslib.NewClient(intPort, HEARTBEAT_INTERVAL)
+func SetupClient(serverAddr string, localAddr string) (client *consensuslib.Client, err error) {
+	return SetupSecureClient(serverAddr, localAddr, nil)
+}
+
+func SetupSecureClient(serverAddr string, localAddr string, sec *security.Config) (client *consensuslib.Client, err error) {
+	log, err := NodeLogger("client", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	client, err = consensuslib.NewClient(localAddr, localAddr, HEARTBEAT_INTERVAL, sec, log)
 	if err != nil {
 		return nil, err
 	}
@@ -24,10 +36,34 @@ func SetupClient(serverAddr string, localPort string) (client *consensuslib.Clie
 }
 
 func SetupServer(serverAddr string) (err error) {
-	server, err := consensuslib.NewServer(serverAddr)
+	return SetupSecureServer(serverAddr, nil)
+}
+
+func SetupSecureServer(serverAddr string, sec *security.Config) (err error) {
+	log, err := NodeLogger("server", serverAddr)
+	if err != nil {
+		return err
+	}
+	server, err := consensuslib.NewServer(serverAddr, sec, log)
 	if err != nil {
 		return err
 	}
 	go server.Serve()
 	return nil
 }
+
+// unbound counts the nodes given port 0, which are told apart by their count instead
+var unbound int32
+
+// NodeLogger creates the logger of the node with the given role at addr, e.g. logs/client12486<time>.log,
+// so that the nodes of a test each log to their own file
+func NodeLogger(role string, addr string) (*logger.Logger, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if port == "0" {
+		port = fmt.Sprintf("0-%d", atomic.AddInt32(&unbound, 1))
+	}
+	return logger.NewFileLogger(role+port, state.QUIET)
+}
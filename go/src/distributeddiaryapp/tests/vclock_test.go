@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"filelogger/vclock"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Vault takes a secret, which must not end up in any log
+type Vault struct{}
+
+func (v *Vault) Open(secret string, opened *bool) error {
+	*opened = secret == "open sesame"
+	return nil
+}
+
+// vaultCall opens the vault over a pipe, with client and server logging clocks to clientLog and serverLog
+func vaultCall(t *testing.T, clientLog *vclock.Logger, serverLog *vclock.Logger) {
+	server := rpc.NewServer()
+	server.Register(&Vault{})
+	clientConn, serverConn := net.Pipe()
+	go vclock.ServeConn(server, serverConn, serverLog)
+	client := vclock.NewClient(clientConn, clientLog)
+	defer client.Close()
+	var opened bool
+	if err := client.Call("Vault.Open", "open sesame", &opened); err != nil || !opened {
+		t.Fatalf("Bad Exit: expected the vault to open, got %v: %v", opened, err)
+	}
+}
+
+func TestVClockRPCMergesClocks(t *testing.T) {
+	clientLog, err := vclock.NewLogger("vclocktest", "client")
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create the client's vector clock log: %v", err)
+	}
+	serverLog, err := vclock.NewLogger("vclocktest", "server")
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create the server's vector clock log: %v", err)
+	}
+	vaultCall(t, clientLog, serverLog)
+	clientLog.Close()
+	serverLog.Close()
+
+	// initialised, sent and got the reply
+	if clock := clientLog.Clock(); clock["client"] != 3 || clock["server"] != 3 {
+		t.Errorf("Bad Exit: expected the client to have merged the server's clock at its reply, got %v", clock)
+	}
+	// initialised, received and replied
+	if clock := serverLog.Clock(); clock["server"] != 3 || clock["client"] != 2 {
+		t.Errorf("Bad Exit: expected the server to have merged the client's clock at its request, got %v", clock)
+	}
+
+	clientFiles, _ := filepath.Glob("logs/vclocktest_client_*.shiviz.log")
+	serverFiles, _ := filepath.Glob("logs/vclocktest_server_*.shiviz.log")
+	files := append(clientFiles, serverFiles...)
+	if len(clientFiles) == 0 || len(serverFiles) == 0 {
+		t.Fatalf("Bad Exit: expected a vector clock log for client and server, got %v", files)
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Bad Exit: unable to read %s: %v", file, err)
+		}
+		if !strings.Contains(string(content), "Vault.Open") {
+			t.Errorf("Bad Exit: expected %s to log the call to Vault.Open, got %s", file, content)
+		}
+		if strings.Contains(string(content), "sesame") {
+			t.Errorf("Bad Exit: expected %s to leave out the body of the call, got %s", file, content)
+		}
+	}
+}
+
+func TestVClockNilLoggerInteroperates(t *testing.T) {
+	serverLog, err := vclock.NewLogger("vclocktest", "nilclient-server")
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create the server's vector clock log: %v", err)
+	}
+	// a client without a Logger sends empty clocks, which leave only the server's own entry
+	vaultCall(t, nil, serverLog)
+	serverLog.Close()
+	if clock := serverLog.Clock(); len(clock) != 1 || clock["nilclient-server"] != 3 {
+		t.Errorf("Bad Exit: expected the server's clock to count only its own events, got %v", clock)
+	}
+
+	clientLog, err := vclock.NewLogger("vclocktest", "nilserver-client")
+	if err != nil {
+		t.Fatalf("Bad Exit: unable to create the client's vector clock log: %v", err)
+	}
+	// and a server without one ignores the clocks it receives
+	vaultCall(t, clientLog, nil)
+	clientLog.Close()
+	if clock := clientLog.Clock(); len(clock) != 1 || clock["nilserver-client"] != 3 {
+		t.Errorf("Bad Exit: expected the client's clock to count only its own events, got %v", clock)
+	}
+}
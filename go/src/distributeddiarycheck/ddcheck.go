@@ -0,0 +1,56 @@
+// Entrypoint for the Distributed Diary Check tool, ddcheck
+// This file can be run with 'go run distributeddiarycheck/ddcheck.go'
+// Or do `cd distributeddiarycheck && go build -o ddcheck && ./ddcheck`
+
+// ddcheck reads the learner logs, acceptor histories and proposals the nodes of a run left in their temp1 directory,
+// and reports every violation of the paxos safety properties, with the slot and the nodes involved
+// Go Run Example: `go run distributeddiarycheck/ddcheck.go temp1`
+
+package main
+
+import (
+	"consensuslib/paxosnode/backup"
+	"consensuslib/paxosnode/safety"
+	"fmt"
+	"os"
+)
+
+const usage = `==================================================
+The Chamber of Secrets: Distributed Diary Check
+==================================================
+Usage: go run ddcheck.go [DIR]
+
+DIR holds the files of every node of the run, temp1 of the directory the apps ran in by default
+Empty DIR before a run, acceptor histories are appended to across runs
+Exits with 1 if any safety property was violated
+`
+
+func main() {
+	dir := backup.DIR
+	switch len(os.Args) {
+	case 1:
+	case 2:
+		dir = os.Args[1]
+	default:
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+	nodes, err := safety.Load(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddcheck: %s\n", err)
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+	for _, n := range nodes {
+		fmt.Printf("%s: learned %d values, made %d acceptor decisions, proposed %d values\n", n.ID, len(n.Learned), len(n.History), len(n.Proposals))
+	}
+	violations := safety.Check(nodes)
+	for _, v := range violations {
+		fmt.Printf("VIOLATION %v\n", v)
+	}
+	if len(violations) > 0 {
+		fmt.Printf("%d violations\n", len(violations))
+		os.Exit(1)
+	}
+	fmt.Println("No violations")
+}
@@ -0,0 +1,193 @@
+// Entrypoint for the Distributed Diary Control tool, ddctl
+// This file can be run with 'go run distributeddiaryctl/ddctl.go'
+// Or do `cd distributeddiaryctl && go build -o ddctl && ./ddctl`
+
+// ddctl drives the paxostracker breakpoints and fault rules of any node by address, so one script can run a whole failure scenario
+// Go Run Example: `go run distributeddiaryctl/ddctl.go 127.0.0.1:2001 break promise peer 127.0.0.1:2002`
+// Go Run Example: `go run distributeddiaryctl/ddctl.go 127.0.0.1:2001 continue`
+// Go Run Example: `go run distributeddiaryctl/ddctl.go 127.0.0.1:2001 fault 127.0.0.1:2002 drop 30 delay 200`
+
+package main
+
+import (
+	"consensuslib"
+	"consensuslib/paxosnode/faults"
+	"consensuslib/security"
+	"fmt"
+	"os"
+	"paxostracker/breakpoint"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	breakCommand       = "break"
+	killCommand        = "kill"
+	breakpointsCommand = "breakpoints"
+	deleteCommand      = "delete"
+	continueCommand    = "continue"
+	stepCommand        = "step"
+	faultCommand       = "fault"
+	faultsCommand      = "faults"
+	partitionCommand   = "partition"
+	healCommand        = "heal"
+	certFlag           = "--cert"
+	keyFlag            = "--key"
+	caFlag             = "--ca"
+	tokenFlag          = "--token"
+	usage              = `==================================================
+The Chamber of Secrets: Distributed Diary Control
+==================================================
+Usage: go run ddctl.go NODEADDRESS COMMAND [options]
+
+Node address must be of the form 255.255.255.255:12345, the address the node listens on.
+The node must have been started with --debug-control.
+
+Commands:
+
+break STAGE [conditions] : break the node before STAGE, see the app's help for stages and conditions
+kill STAGE [conditions] : kill the node before STAGE
+breakpoints : list the breakpoints armed on the node, and where it is paused
+delete N : disarm the breakpoint with ID N
+continue : continue the node from its breakpoint
+step : continue the node, breaking again at the next stage, or at the next reply or notice counted
+fault PEER [drop N] [dropreply N] [delay MS] [duplicate] [partition] : inject faults into the node's calls to PEER, or to every peer if PEER is *
+faults : list the fault rules set on the node
+partition PEER [PEER...] : partition the node from every peer given, run it on both sides for a clean split
+heal [PEER...] : remove the node's fault rules for the peers given, or all of them
+
+Valid options:
+
+--cert PATH --key PATH --ca PATH : use mutual TLS, with a certificate and key signed by the cluster CA
+--token SECRET : prove knowledge of the cluster join token to the node
+`
+)
+
+var validArgs = regexp.MustCompile("^[0-9]{1,3}\\.[0-9]{1,3}\\.[0-9]{1,3}\\.[0-9]{1,3}:[0-9]{1,5} (" + breakCommand + "|" + killCommand + "|" + breakpointsCommand + "|" + deleteCommand + " [0-9]+|" + continueCommand + "|" + stepCommand + "|" + faultsCommand + "|" + faultCommand + " [^ ]+|" + partitionCommand + " [^ ]+|" + healCommand + ")( |$)")
+
+func main() {
+	nodeAddr, command, words, sec, err := parseArgs(os.Args[1:])
+	checkError(err)
+	ctl, err := consensuslib.DialDebug(nodeAddr, sec)
+	checkError(err)
+	defer ctl.Close()
+
+	switch command {
+	case breakCommand, killCommand:
+		b, err := breakpoint.Parse(words)
+		checkError(err)
+		b.Kill = command == killCommand
+		b.ID, err = ctl.Break(b)
+		checkError(err)
+		fmt.Printf("%s: armed breakpoint %v\n", nodeAddr, b)
+	case breakpointsCommand:
+		breakpoints, err := ctl.Breakpoints()
+		checkError(err)
+		paused, err := ctl.Paused()
+		checkError(err)
+		if len(breakpoints) == 0 {
+			fmt.Printf("%s: no breakpoints armed\n", nodeAddr)
+		}
+		for _, b := range breakpoints {
+			fmt.Printf("%s: %v\n", nodeAddr, b)
+		}
+		for _, ctx := range paused {
+			fmt.Printf("%s: paused before %v\n", nodeAddr, ctx)
+		}
+	case deleteCommand:
+		id, _ := strconv.Atoi(words[0])
+		checkError(ctl.Delete(id))
+		fmt.Printf("%s: deleted breakpoint %d\n", nodeAddr, id)
+	case continueCommand:
+		checkError(ctl.Continue())
+		fmt.Printf("%s: continuing...\n", nodeAddr)
+	case stepCommand:
+		next, err := ctl.Step()
+		checkError(err)
+		if len(next) == 0 {
+			fmt.Printf("%s: stepped beyond the end of the round, continuing...\n", nodeAddr)
+			break
+		}
+		fmt.Printf("%s: breaking at the next of %s\n", nodeAddr, breakpoint.Join(next))
+	case faultCommand:
+		r, err := faults.Parse(words)
+		checkError(err)
+		checkError(ctl.SetFault(r))
+		fmt.Printf("%s: injecting faults %v\n", nodeAddr, r)
+	case faultsCommand:
+		rules, err := ctl.Faults()
+		checkError(err)
+		if len(rules) == 0 {
+			fmt.Printf("%s: no faults injected\n", nodeAddr)
+		}
+		for _, r := range rules {
+			fmt.Printf("%s: %v\n", nodeAddr, r)
+		}
+	case partitionCommand:
+		checkError(ctl.Partition(words))
+		fmt.Printf("%s: partitioned from %s\n", nodeAddr, strings.Join(words, " "))
+	case healCommand:
+		checkError(ctl.Heal(words))
+		fmt.Printf("%s: healed faults\n", nodeAddr)
+	}
+}
+
+// parseArgs splits the command line into the node address, the command, the command's words, and the security options
+func parseArgs(args []string) (nodeAddr string, command string, words []string, sec *security.Config, err error) {
+	if !validArgs.MatchString(strings.Join(args, " ")) {
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+	nodeAddr = args[0]
+	command = args[1]
+	tlsFiles := make(map[string]string)
+	joinToken := ""
+	for i := 2; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case certFlag, keyFlag, caFlag:
+			if i+1 >= len(args) {
+				return nodeAddr, command, words, sec, fmt.Errorf("missing path after %s", arg)
+			}
+			i++
+			tlsFiles[arg] = args[i]
+		case tokenFlag:
+			if i+1 >= len(args) {
+				return nodeAddr, command, words, sec, fmt.Errorf("missing secret after %s", arg)
+			}
+			i++
+			joinToken = args[i]
+		default:
+			words = append(words, arg)
+		}
+	}
+	sec, err = securityFromFlags(tlsFiles, joinToken)
+	return nodeAddr, command, words, sec, err
+}
+
+// securityFromFlags loads mutual TLS when all of --cert, --key and --ca were given, and sets the join token
+func securityFromFlags(tlsFiles map[string]string, joinToken string) (sec *security.Config, err error) {
+	if len(tlsFiles) == 0 && joinToken == "" {
+		return nil, nil
+	}
+	sec = &security.Config{JoinToken: joinToken}
+	if len(tlsFiles) == 0 {
+		return sec, nil
+	}
+	if len(tlsFiles) != 3 {
+		return nil, fmt.Errorf("%s, %s and %s must be given together", certFlag, keyFlag, caFlag)
+	}
+	sec.TLS, err = security.LoadTLSConfig(tlsFiles[certFlag], tlsFiles[keyFlag], tlsFiles[caFlag])
+	if err != nil {
+		return nil, fmt.Errorf("error while loading TLS config: %s", err)
+	}
+	return sec, nil
+}
+
+func checkError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddctl: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+// Entrypoint for the Distributed Diary Replay tool, ddreplay
+// This file can be run with 'go run distributeddiaryreplay/ddreplay.go'
+// Or do `cd distributeddiaryreplay && go build -o ddreplay && ./ddreplay`
+
+// ddreplay feeds a trace recorded by an app started with --trace into a fresh paxos node,
+// and reports every decision the fresh node made differently from the recorded one
+// Go Run Example: `go run distributeddiaryreplay/ddreplay.go node1.trace`
+
+package main
+
+import (
+	"consensuslib/paxosnode"
+	"consensuslib/paxosnode/trace"
+	"filelogger/singletonlogger"
+	"filelogger/state"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const usage = `==================================================
+The Chamber of Secrets: Distributed Diary Replay
+==================================================
+Usage: go run ddreplay.go TRACEFILE
+
+Trace file must have been recorded by an app run with --trace TRACEFILE
+Exits with 1 if the replayed node diverged from the recorded one
+`
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+	tracePath, err := filepath.Abs(os.Args[1])
+	checkError(err)
+	f, err := os.Open(tracePath)
+	checkError(err)
+	events, err := trace.Read(f)
+	f.Close()
+	checkError(err)
+
+	// the replayed node keeps its acceptor backups and logs in the working directory, keep them away from real ones
+	dir, err := ioutil.TempDir("", "ddreplay")
+	checkError(err)
+	checkError(os.Chdir(dir))
+	checkError(singletonlogger.NewSingletonLogger("replay", state.NORMAL))
+
+	pn, divergences, err := paxosnode.Replay(events, singletonlogger.Get())
+	checkError(err)
+	received := 0
+	for _, e := range events {
+		if e.Direction == trace.RECEIVE {
+			received++
+		}
+	}
+	fmt.Printf("%s: replayed %d events, %d of them received messages\n", pn.Addr, len(events), received)
+	for _, d := range divergences {
+		fmt.Printf("DIVERGED at %v\n", d)
+	}
+	log, _ := pn.GetLog()
+	fmt.Printf("Replayed log (%d values):\n", len(log))
+	for i, m := range log {
+		fmt.Printf("%d: %s\n", i, m.Value)
+	}
+	os.RemoveAll(dir)
+	if len(divergences) > 0 {
+		fmt.Printf("%d divergences\n", len(divergences))
+		os.Exit(1)
+	}
+	fmt.Println("No divergences")
+}
+
+func checkError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddreplay: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -12,6 +12,10 @@ package main
 
 import (
 	"consensuslib"
+	"consensuslib/security"
+	"filelogger/level"
+	"filelogger/logger"
+	"filelogger/rotate"
 	"filelogger/singletonlogger"
 	"filelogger/state"
 	"fmt"
@@ -19,12 +23,28 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	localFlag = "--local"
-	debugFlag = "--debug"
-	usage     = `==================================================
+	localFlag   = "--local"
+	debugFlag   = "--debug"
+	suspectFlag = "--suspect-after"
+	deadFlag    = "--dead-after"
+	certFlag    = "--cert"
+	keyFlag     = "--key"
+	caFlag      = "--ca"
+	tokenFlag   = "--token"
+	vclockFlag  = "--vclock"
+	jsonLogFlag = "--jsonlog"
+	maxSizeFlag = "--log-max-size"
+	maxAgeFlag  = "--log-max-age"
+	keepFlag    = "--log-keep"
+	gzipFlag    = "--log-gzip"
+	asyncFlag   = "--log-async"
+	syslogFlag  = "--syslog"
+	metricsFlag = "--metrics"
+	usage       = `==================================================
 The Chamber of Secrets: A Distributed Diary Server
 ==================================================
 Usage: go run server.go PORT [options]
@@ -33,40 +53,76 @@ Valid options:
 
 --local : run on local machine at 127.0.0.1 with the specified port
 --debug : run with debuggging turned on for verbose logging
+--suspect-after DURATION : mark a node suspected after this long without a heartbeat (default 1s)
+--dead-after DURATION : drop a node after this long without a heartbeat (default 2s)
+--cert PATH --key PATH --ca PATH : require mutual TLS, with the server's certificate and key, and the cluster CA
+--token SECRET : only register nodes that prove knowledge of this cluster join token
+--vclock : also log with vector clocks carried on every RPC, to a ShiViz log in logs/
+--jsonlog : also log every entry with its fields as a JSON line, to a .jsonl log in logs/
+--log-max-size MB : start a new log file once the current one would grow past this many megabytes
+--log-max-age DURATION : start a new log file once the current one is this old, e.g. 24h
+--log-keep N : keep only the newest N files of each log, older runs' included, removing the oldest
+--log-gzip : gzip log files once a new one is started
+--log-async : write logs from a buffer in the background, flushed every second and on exit
+--syslog ADDR : also send log entries at info and above to the syslog server at ADDR over UDP, e.g. 127.0.0.1:514
+--metrics ADDR : serve Prometheus metrics over HTTP at http://ADDR/metrics, e.g. 127.0.0.1:9100
 `
 )
 
-var validArgs = regexp.MustCompile("[0-9]{1,5}( " + localFlag + ")*( " + debugFlag + ")*")
+var validArgs = regexp.MustCompile("[0-9]{1,5}( " + localFlag + ")*( " + debugFlag + ")*( " + vclockFlag + ")*( " + jsonLogFlag + ")*( (" + gzipFlag + "|" + asyncFlag + "))*( (" + maxSizeFlag + "|" + maxAgeFlag + "|" + keepFlag + ") [0-9a-z.]+)*( " + suspectFlag + " [0-9a-z.]+)*( " + deadFlag + " [0-9a-z.]+)*( (" + certFlag + "|" + keyFlag + "|" + caFlag + "|" + tokenFlag + "|" + syslogFlag + "|" + metricsFlag + ") [^ ]+)*")
 
 func main() {
-	addr, logstate, err := parseArgs(os.Args[1:])
+	addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, err := parseArgs(os.Args[1:])
 	checkError(err)
-	err = singletonlogger.NewSingletonLogger("server", logstate)
+	err = singletonlogger.NewRotatingSingletonLogger("server", logstate, rotation)
 	checkError(err)
+	if jsonLogs {
+		err = singletonlogger.EnableJSON()
+		checkError(err)
+	}
+	if syslogAddr != "" {
+		syslog, err := logger.NewSyslogSink(syslogAddr, "server")
+		checkError(err)
+		checkError(singletonlogger.AddSink(syslog, level.INFO))
+	}
 	singletonlogger.Debug("Logger created")
 	singletonlogger.Debug("Chosen Addr: " + addr)
 	singletonlogger.Debug("Creating consensuslib server for " + addr)
-	server, err := consensuslib.NewServer(addr)
+	server, err := consensuslib.NewServer(addr, sec, singletonlogger.Get())
+	checkError(err)
+	err = server.SetHeartBeatConfig(heartBeatConfig)
 	checkError(err)
+	if vectorClocks {
+		err = server.LogVectorClocks()
+		checkError(err)
+	}
+	if metricsAddr != "" {
+		_, err = server.ServeMetrics(metricsAddr)
+		checkError(err)
+	}
 	singletonlogger.Info("Serving at " + addr)
 	err = server.Serve()
 	checkError(err)
 }
 
-func parseArgs(args []string) (addr string, logstate state.State, err error) {
+func parseArgs(args []string) (addr string, logstate state.State, heartBeatConfig consensuslib.HeartBeatConfig, sec *security.Config, vectorClocks bool, jsonLogs bool, syslogAddr string, metricsAddr string, rotation rotate.Config, err error) {
 	if !validArgs.MatchString(strings.Join(args, " ")) {
 		fmt.Println(usage)
 		os.Exit(1)
 	}
 	port := 0
 	isLocal := false
-	for i, arg := range args {
+	heartBeatConfig = consensuslib.DefaultHeartBeatConfig
+	tlsFiles := make(map[string]string)
+	joinToken := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
 		// positional args
 		switch i {
 		case 0:
 			port, err = strconv.Atoi(args[i])
 			if err != nil {
-				return addr, logstate, fmt.Errorf("error while converting port: %s", err)
+				return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("error while converting port: %s", err)
 			}
 		default:
 			// option flags
@@ -75,21 +131,123 @@ func parseArgs(args []string) (addr string, logstate state.State, err error) {
 				isLocal = true
 			case debugFlag:
 				logstate = state.DEBUGGING
+			case vclockFlag:
+				vectorClocks = true
+			case jsonLogFlag:
+				jsonLogs = true
+			case gzipFlag:
+				rotation.Compress = true
+			case asyncFlag:
+				rotation.Async = true
+			case maxSizeFlag, maxAgeFlag, keepFlag:
+				if i+1 >= len(args) {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("missing value after %s", arg)
+				}
+				i++
+				err = rotationFromFlag(&rotation, arg, args[i])
+				if err != nil {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, err
+				}
+			case suspectFlag, deadFlag:
+				if i+1 >= len(args) {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("missing duration after %s", arg)
+				}
+				i++
+				d, err := time.ParseDuration(args[i])
+				if err != nil {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("error while converting %s: %s", arg, err)
+				}
+				if arg == suspectFlag {
+					heartBeatConfig.SuspectAfter = d
+				} else {
+					heartBeatConfig.DeadAfter = d
+				}
+			case certFlag, keyFlag, caFlag:
+				if i+1 >= len(args) {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("missing path after %s", arg)
+				}
+				i++
+				tlsFiles[arg] = args[i]
+			case metricsFlag:
+				if i+1 >= len(args) {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("missing address after %s", arg)
+				}
+				i++
+				metricsAddr = args[i]
+			case syslogFlag:
+				if i+1 >= len(args) {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("missing address after %s", arg)
+				}
+				i++
+				syslogAddr = args[i]
+			case tokenFlag:
+				if i+1 >= len(args) {
+					return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, fmt.Errorf("missing secret after %s", arg)
+				}
+				i++
+				joinToken = args[i]
 			}
 		}
 	}
+	sec, err = securityFromFlags(tlsFiles, joinToken)
+	if err != nil {
+		return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, err
+	}
 	addrEnd := fmt.Sprintf(":%d", port)
 	if isLocal {
 		addr = "127.0.0.1" + addrEnd
 	} else {
 		addr = addrEnd
 	}
-	return addr, logstate, nil
+	return addr, logstate, heartBeatConfig, sec, vectorClocks, jsonLogs, syslogAddr, metricsAddr, rotation, nil
+}
+
+// securityFromFlags loads mutual TLS when all of --cert, --key and --ca were given, and sets the join token
+func securityFromFlags(tlsFiles map[string]string, joinToken string) (sec *security.Config, err error) {
+	if len(tlsFiles) == 0 && joinToken == "" {
+		return nil, nil
+	}
+	sec = &security.Config{JoinToken: joinToken}
+	if len(tlsFiles) == 0 {
+		return sec, nil
+	}
+	if len(tlsFiles) != 3 {
+		return nil, fmt.Errorf("%s, %s and %s must be given together", certFlag, keyFlag, caFlag)
+	}
+	sec.TLS, err = security.LoadTLSConfig(tlsFiles[certFlag], tlsFiles[keyFlag], tlsFiles[caFlag])
+	if err != nil {
+		return nil, fmt.Errorf("error while loading TLS config: %s", err)
+	}
+	return sec, nil
+}
+
+// rotationFromFlag sets the part of rotation given by the flag arg
+func rotationFromFlag(rotation *rotate.Config, arg string, value string) (err error) {
+	switch arg {
+	case maxSizeFlag:
+		megabytes, err := strconv.ParseFloat(value, 64)
+		if err != nil || megabytes <= 0 {
+			return fmt.Errorf("error while converting %s: %s is not a positive number of megabytes", arg, value)
+		}
+		rotation.MaxSize = int64(megabytes * 1024 * 1024)
+	case maxAgeFlag:
+		rotation.MaxAge, err = time.ParseDuration(value)
+		if err != nil || rotation.MaxAge <= 0 {
+			return fmt.Errorf("error while converting %s: %s is not a positive duration", arg, value)
+		}
+	case keepFlag:
+		rotation.MaxFiles, err = strconv.Atoi(value)
+		if err != nil || rotation.MaxFiles <= 0 {
+			return fmt.Errorf("error while converting %s: %s is not a positive number of files", arg, value)
+		}
+	}
+	return nil
 }
 
 func checkError(err error) {
 	if err != nil {
 		singletonlogger.Fatal(err.Error())
+		singletonlogger.Exit()
 		os.Exit(1)
 	}
 }
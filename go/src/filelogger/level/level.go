@@ -1,5 +1,10 @@
 package level
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Level of a log statement
 type Level string
 
@@ -16,3 +21,36 @@ const (
 	// FATAL - something has gone wrong, and the application cannot continue
 	FATAL Level = "Fatal  "
 )
+
+// Levels are all levels, from the least to the most severe
+var Levels = []Level{DEBUG, INFO, WARNING, ERROR, FATAL}
+
+// severity of each level, its position in Levels
+func (l Level) severity() int {
+	for i, known := range Levels {
+		if l == known {
+			return i
+		}
+	}
+	return len(Levels)
+}
+
+// AtLeast is true when l is as severe as min or more
+func (l Level) AtLeast(min Level) bool {
+	return l.severity() >= min.severity()
+}
+
+// Name of the level, without the padding, e.g. "Debug"
+func (l Level) Name() string {
+	return strings.TrimSpace(string(l))
+}
+
+// Parse a level from its name, in any case, e.g. "debug" or "Warning"
+func Parse(name string) (Level, error) {
+	for _, l := range Levels {
+		if strings.EqualFold(l.Name(), name) {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown level '%s'", name)
+}
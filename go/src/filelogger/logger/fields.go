@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"filelogger/level"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+	Structured logging: an entry can carry fields besides its message, e.g.
+		singletonlogger.With(logger.Fields{logger.NODE: addr, logger.ROUND: 3}).Debug("value learned")
+	The text log shows them after the message as key=value pairs, and the JSON log (see EnableJSON) as keys of the entry.
+*/
+
+// Fields are the key/value pairs of a structured log entry
+type Fields map[string]interface{}
+
+// NODE is the address of the node an entry is about
+const NODE = "node"
+
+// ROUND is the paxos round (slot) an entry is about
+const ROUND = "round"
+
+// MSGID is the ID of the paxos message an entry is about
+const MSGID = "msgID"
+
+// PEER is the other node involved
+const PEER = "peer"
+
+// PHASE is the paxos phase, e.g. prepare or accept
+const PHASE = "phase"
+
+// String shows the fields as key=value pairs, sorted by key
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", k, f[k])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Entry is a log entry with fields, logged at a level by its methods
+type Entry struct {
+	logger *Logger
+	fields Fields
+}
+
+// With starts an entry carrying fields
+func (l *Logger) With(fields Fields) *Entry {
+	return &Entry{logger: l, fields: fields}
+}
+
+// With adds fields to a copy of the entry, replacing those with the same keys
+func (e *Entry) With(fields Fields) *Entry {
+	merged := make(Fields, len(e.fields)+len(fields))
+	for k, v := range e.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Entry{logger: e.logger, fields: merged}
+}
+
+// Debug Level log
+func (e *Entry) Debug(data string) {
+	e.log(level.DEBUG, data)
+}
+
+// Info Level log
+func (e *Entry) Info(data string) {
+	e.log(level.INFO, data)
+}
+
+// Warning Level log
+func (e *Entry) Warning(data string) {
+	e.log(level.WARNING, data)
+}
+
+// Error Level log
+func (e *Entry) Error(data string) {
+	e.log(level.ERROR, data)
+}
+
+// Fatal Level log
+func (e *Entry) Fatal(data string) {
+	e.log(level.FATAL, data)
+}
+
+// Debugf Level log
+func (e *Entry) Debugf(format string, args ...interface{}) {
+	e.logf(level.DEBUG, format, args...)
+}
+
+// Infof Level log
+func (e *Entry) Infof(format string, args ...interface{}) {
+	e.logf(level.INFO, format, args...)
+}
+
+// Warnf Level log
+func (e *Entry) Warnf(format string, args ...interface{}) {
+	e.logf(level.WARNING, format, args...)
+}
+
+// Errorf Level log
+func (e *Entry) Errorf(format string, args ...interface{}) {
+	e.logf(level.ERROR, format, args...)
+}
+
+// Fatalf Level log
+func (e *Entry) Fatalf(format string, args ...interface{}) {
+	e.logf(level.FATAL, format, args...)
+}
+
+// logf formats the data only if givenLevel is enabled
+func (e *Entry) logf(givenLevel level.Level, format string, args ...interface{}) {
+	if e.logger != nil && !e.logger.Enabled(givenLevel, format) {
+		return
+	}
+	e.log(givenLevel, fmt.Sprintf(format, args...))
+}
+
+// log the entry, a nil logger prints it to stderr
+func (e *Entry) log(givenLevel level.Level, data string) {
+	e.logger.LogFields(givenLevel, data, e.fields)
+}
@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"filelogger/level"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+	Per component levels: a message is attributed to the component its text starts with, e.g. "[paxosnode] ..."
+	is logged by [paxosnode]. Messages of a component below its level are dropped before they are formatted.
+	Components are matched regardless of case, so [Acceptor] and [acceptor] are the same.
+	Components without a level of their own use the default level, DEBUG until set.
+*/
+
+// DEFAULT is the component whose level applies to all components without one
+const DEFAULT = "*"
+
+var componentRegex = regexp.MustCompile(`^\[[^\]]+\]`)
+
+// componentOf the message or format data, DEFAULT when it has no [component] prefix
+func componentOf(data string) string {
+	component := componentRegex.FindString(data)
+	if component == "" {
+		return DEFAULT
+	}
+	return strings.ToLower(component)
+}
+
+// SetLevel makes the logger drop the messages of component less severe than min.
+// Use DEFAULT for every component without a level of its own.
+func (l *Logger) SetLevel(component string, min level.Level) {
+	l.levelsLock.Lock()
+	defer l.levelsLock.Unlock()
+	if l.levels == nil {
+		l.levels = make(map[string]level.Level)
+	}
+	l.levels[strings.ToLower(component)] = min
+}
+
+// ResetLevel makes component use the default level again
+func (l *Logger) ResetLevel(component string) {
+	l.levelsLock.Lock()
+	defer l.levelsLock.Unlock()
+	delete(l.levels, strings.ToLower(component))
+}
+
+// Levels lists the levels set, as "component level" sorted by component, the default first
+func (l *Logger) Levels() []string {
+	l.levelsLock.RLock()
+	defer l.levelsLock.RUnlock()
+	listed := []string{fmt.Sprintf("%s %s", DEFAULT, l.levelOf(DEFAULT).Name())}
+	for component, min := range l.levels {
+		if component != DEFAULT {
+			listed = append(listed, fmt.Sprintf("%s %s", component, min.Name()))
+		}
+	}
+	sort.Strings(listed[1:])
+	return listed
+}
+
+// Enabled is true when a message at givenLevel starting with data would be logged anywhere
+func (l *Logger) Enabled(givenLevel level.Level, data string) bool {
+	if l == nil {
+		return true
+	}
+	if !l.sinkTakes(givenLevel) {
+		return false
+	}
+	l.levelsLock.RLock()
+	defer l.levelsLock.RUnlock()
+	if len(l.levels) == 0 {
+		return true
+	}
+	return givenLevel.AtLeast(l.levelOf(componentOf(data)))
+}
+
+// sinkTakes is true when some sink gets the records at givenLevel
+func (l *Logger) sinkTakes(givenLevel level.Level) bool {
+	l.sinksLock.RLock()
+	defer l.sinksLock.RUnlock()
+	for _, attached := range l.sinks {
+		if givenLevel.AtLeast(attached.min) {
+			return true
+		}
+	}
+	return false
+}
+
+// levelOf component, with the levels locked
+func (l *Logger) levelOf(component string) level.Level {
+	if min, ok := l.levels[component]; ok {
+		return min
+	}
+	if min, ok := l.levels[DEFAULT]; ok {
+		return min
+	}
+	return level.DEBUG
+}
+
+// Logf formats the data per format and args only if givenLevel is enabled, then logs it
+func (l *Logger) Logf(givenLevel level.Level, format string, args ...interface{}) {
+	if !l.Enabled(givenLevel, format) {
+		return
+	}
+	l.Log(givenLevel, fmt.Sprintf(format, args...))
+}
+
+// Debugf Level log
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Logf(level.DEBUG, format, args...)
+}
+
+// Infof Level log
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Logf(level.INFO, format, args...)
+}
+
+// Warnf Level log
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.Logf(level.WARNING, format, args...)
+}
+
+// Errorf Level log
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Logf(level.ERROR, format, args...)
+}
+
+// Fatalf Level log
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.Logf(level.FATAL, format, args...)
+}
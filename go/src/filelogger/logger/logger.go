@@ -2,30 +2,57 @@ package logger
 
 import (
 	"filelogger/level"
+	"filelogger/rotate"
 	"filelogger/state"
 	"fmt"
-	"log"
 	"os"
+	"sync"
 	"time"
 )
 
 /*
-	It would be brilliant to support a format call like in fmt.Printf
-	Currently most calls look like: logger.Info(fmt.Sprintf("this is an example %v", valuedthing))
+	Messages can be logged as they are, logger.Info("..."), or formatted like fmt.Printf, logger.Infof("... %v", thing).
+	The latter is only formatted when the message is going to be logged at all (see levels.go).
 */
 
-// Logger is a logger which can log to disk
+// Logger is a logger which can log to disk, and to any other sinks added.
+// A nil Logger prints what it is given to stderr, warning once that it is uninitialised.
 type Logger struct {
-	name  string
-	log   *log.Logger
-	file  *os.File
-	state state.State
+	name     string
+	json     *FileSink     // JSON lines log, nil until EnableJSON
+	rotation rotate.Config // of the log files
+	state    state.State
+
+	sinksLock sync.RWMutex
+	sinks     []attachedSink
+
+	// minimum levels per component, see levels.go
+	levelsLock sync.RWMutex
+	levels     map[string]level.Level
+}
+
+// attachedSink is a sink with the minimum level of the records it gets
+type attachedSink struct {
+	sink Sink
+	min  level.Level
 }
 
 var globalLoggers = make(map[string]*Logger)
 
-// NewFileLogger creates a new logger that may log to disk
+// uninitialised warns once that a nil Logger is in use
+var uninitialised sync.Once
+
+// TIMEGLOB matches the times in the names of log files
+const TIMEGLOB = "[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]_[0-9][0-9]:[0-9][0-9]:[0-9][0-9]"
+
+// NewFileLogger creates a new logger that may log to disk, to a file that grows for as long as the logger runs
 func NewFileLogger(loggerName string, state state.State) (logger *Logger, err error) {
+	return NewRotatingFileLogger(loggerName, state, rotate.Config{})
+}
+
+// NewRotatingFileLogger creates a new logger that may log to disk, rotating its files per rotation.
+// The files kept include those of earlier loggers by the same name.
+func NewRotatingFileLogger(loggerName string, state state.State, rotation rotate.Config) (logger *Logger, err error) {
 	if globalLoggers[loggerName] != nil {
 		return globalLoggers[loggerName], nil
 	}
@@ -34,21 +61,45 @@ func NewFileLogger(loggerName string, state state.State) (logger *Logger, err er
 	if err != nil {
 		return nil, fmt.Errorf("unable to create log folder: %s", err)
 	}
-	// open file for writing
-	f, err := os.Create("logs/" + loggerName + timeNow() + ".log")
-	if err != nil {
-		return nil, fmt.Errorf("unable to create log file: %s", err)
-	}
 	logger = &Logger{
-		name:  loggerName,
-		log:   log.New(os.Stderr, fmt.Sprintf("[%s] ", loggerName), log.Ltime|log.Lmicroseconds),
-		file:  f,
-		state: state,
+		name:     loggerName,
+		rotation: rotation,
+		state:    state,
+	}
+	err = logger.addStateSinks()
+	if err != nil {
+		return nil, err
 	}
 	globalLoggers[loggerName] = logger
 	return logger, nil
 }
 
+// addStateSinks adds the file and console sinks the state of the logger asks for
+func (l *Logger) addStateSinks() error {
+	if l.state != state.NOWRITE {
+		file, err := NewFileSink("logs/"+l.name+timeNow()+".log", "logs/"+l.name+TIMEGLOB+".log*", l.rotation)
+		if err != nil {
+			return err
+		}
+		l.AddSink(file, level.DEBUG)
+	}
+	switch l.state {
+	case state.QUIET:
+		// nothing on the console
+	case state.DEBUGGING:
+		l.AddSink(NewConsoleSink(l.name), level.DEBUG)
+	default:
+		l.AddSink(NewConsoleSink(l.name), level.INFO)
+	}
+	return nil
+}
+
+// NewDiscardLogger creates a logger that logs nowhere until sinks are added to it, for components given no logger.
+// It is not registered by name, so it never stands in for a file logger of the same name.
+func NewDiscardLogger(loggerName string) *Logger {
+	return &Logger{name: loggerName, state: state.NOWRITE}
+}
+
 // GetLogger by loggerName if it exists, or create a new normal logger by that name
 func GetLogger(loggerName string) (logger *Logger) {
 	if globalLoggers[loggerName] != nil {
@@ -62,42 +113,95 @@ func GetLogger(loggerName string) (logger *Logger) {
 	return logger
 }
 
-// Exit the logger
-func (l *Logger) Exit() {
-	l.file.Close()
+// AddSink makes the logger also write the records at min or above to sink
+func (l *Logger) AddSink(sink Sink, min level.Level) {
+	l.sinksLock.Lock()
+	defer l.sinksLock.Unlock()
+	l.sinks = append(l.sinks, attachedSink{sink, min})
 }
 
-// Log takes a level and some data to be logged per the logger state
-func (l *Logger) Log(givenLevel level.Level, data string) {
-	if l.file == nil || l.log == nil {
-		fmt.Println("ERROR: Log is incorrectly initialized")
+// RemoveSink stops the logger writing to sink, without closing it
+func (l *Logger) RemoveSink(sink Sink) {
+	l.sinksLock.Lock()
+	defer l.sinksLock.Unlock()
+	kept := l.sinks[:0]
+	for _, attached := range l.sinks {
+		if attached.sink != sink {
+			kept = append(kept, attached)
+		}
+	}
+	l.sinks = kept
+}
+
+// EnableJSON also writes every entry, with its fields, to a JSON lines file next to the text log.
+// Each line is an object with the keys time, logger, level and msg, and one key per field.
+func (l *Logger) EnableJSON() (err error) {
+	if l.json != nil {
+		return nil
+	}
+	l.json, err = NewJSONFileSink("logs/"+l.name+timeNow()+".jsonl", "logs/"+l.name+TIMEGLOB+".jsonl*", l.rotation)
+	if err != nil {
+		return err
+	}
+	l.AddSink(l.json, level.DEBUG)
+	return nil
+}
+
+// Exit the logger, closing every sink after writing what is buffered
+func (l *Logger) Exit() {
+	if l == nil {
 		return
 	}
+	l.sinksLock.Lock()
+	defer l.sinksLock.Unlock()
+	for _, attached := range l.sinks {
+		attached.sink.Close()
+	}
+	l.sinks = nil
+}
 
-	logString := fmt.Sprintf("| %s | %s", givenLevel, data)
-	switch l.state {
-	case state.NOWRITE:
-		// Do not write anything
-	default:
-		lineHeader := fmt.Sprintf("[ %s | %s ]", l.name, timeNow())
-		_, err := l.file.WriteString(lineHeader + logString + "\n")
-		if err != nil {
-			fmt.Printf("write failed: %s\n", err)
+// Flush what is buffered to the sinks that buffer
+func (l *Logger) Flush() {
+	if l == nil {
+		return
+	}
+	l.sinksLock.RLock()
+	defer l.sinksLock.RUnlock()
+	for _, attached := range l.sinks {
+		if flusher, ok := attached.sink.(interface{ Flush() error }); ok {
+			flusher.Flush()
 		}
 	}
+}
 
-	switch givenLevel {
-	case level.DEBUG:
-		if l.state == state.DEBUGGING {
-			l.log.Print(logString)
-		}
-	case level.INFO:
-		if l.state != state.QUIET {
-			fmt.Println(data)
+// Log takes a level and some data to be logged per the logger state
+func (l *Logger) Log(givenLevel level.Level, data string) {
+	l.LogFields(givenLevel, data, nil)
+}
+
+// LogFields takes a level, some data and the fields describing it to be logged to every sink taking the level
+func (l *Logger) LogFields(givenLevel level.Level, data string, fields Fields) {
+	if l == nil {
+		uninitialised.Do(func() {
+			fmt.Fprintln(os.Stderr, "LOGGING ERROR: Logger uninitialised!")
+		})
+		if len(fields) > 0 {
+			fmt.Fprintln(os.Stderr, data, fields)
+		} else {
+			fmt.Fprintln(os.Stderr, data)
 		}
-	default:
-		if l.state != state.QUIET {
-			l.log.Print(logString)
+		return
+	}
+	if !l.Enabled(givenLevel, data) {
+		return
+	}
+	r := Record{Time: time.Now(), Logger: l.name, Level: givenLevel, Msg: data, Fields: fields}
+	l.sinksLock.RLock()
+	defer l.sinksLock.RUnlock()
+	for _, attached := range l.sinks {
+		if givenLevel.AtLeast(attached.min) {
+			// sinks report their own errors, where they can't get lost in the log
+			attached.sink.Write(r)
 		}
 	}
 }
@@ -0,0 +1,244 @@
+package logger
+
+import (
+	"encoding/json"
+	"filelogger/level"
+	"filelogger/rotate"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	Sinks are where a Logger's entries go. Each sink is added with its own minimum level, l.AddSink(sink, level.ERROR),
+	and only gets the entries at that level or above, once they passed the component levels (see levels.go).
+	Built in are files (text or JSON lines), the console, an in-memory ring buffer and syslog over UDP.
+	Sinks report their own write errors to stderr, once until writing succeeds again, as the log itself may be failing.
+*/
+
+// Sink receives the entries of a Logger
+type Sink interface {
+	Write(r Record) error
+	Close() error
+}
+
+// Record is one entry as given to sinks
+type Record struct {
+	Time   time.Time
+	Logger string
+	Level  level.Level
+	Msg    string
+	Fields Fields
+}
+
+// String of the record as in the text log, e.g. "| Debug   | [paxosnode] prepare | node=:2001 round=3"
+func (r Record) String() string {
+	s := fmt.Sprintf("| %s | %s", r.Level, r.Msg)
+	if len(r.Fields) > 0 {
+		s += " | " + r.Fields.String()
+	}
+	return s
+}
+
+// MarshalJSON as an object with the keys time, logger, level and msg, and one key per field
+func (r Record) MarshalJSON() ([]byte, error) {
+	entry := make(map[string]interface{}, len(r.Fields)+4)
+	for k, v := range r.Fields {
+		entry[k] = v
+	}
+	entry["time"] = r.Time.Format(time.RFC3339Nano)
+	entry["logger"] = r.Logger
+	entry["level"] = r.Level.Name()
+	entry["msg"] = r.Msg
+	return json.Marshal(entry)
+}
+
+// FileSink writes records to a rotating file, one line each
+type FileSink struct {
+	file *rotate.Writer
+	json bool
+}
+
+// NewFileSink writes records as text lines to the file at path, see rotate.NewWriter
+func NewFileSink(path string, pattern string, rotation rotate.Config) (*FileSink, error) {
+	file, err := rotate.NewWriter(path, pattern, rotation)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// NewJSONFileSink writes records as JSON lines to the file at path, see rotate.NewWriter
+func NewJSONFileSink(path string, pattern string, rotation rotate.Config) (*FileSink, error) {
+	file, err := rotate.NewWriter(path, pattern, rotation)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create JSON log file: %s", err)
+	}
+	return &FileSink{file: file, json: true}, nil
+}
+
+// Write the record, the file reports its own errors
+func (s *FileSink) Write(r Record) (err error) {
+	var line []byte
+	if s.json {
+		line, err = json.Marshal(r)
+		if err != nil {
+			return err
+		}
+	} else {
+		line = []byte(fmt.Sprintf("[ %s | %s ]%s", r.Logger, r.Time.Format("2006-01-02_15:04:05"), r))
+	}
+	// one write per line, so entries logged at once are not interleaved
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Flush what is buffered to the file
+func (s *FileSink) Flush() error {
+	return s.file.Flush()
+}
+
+// Close the file, after writing what is buffered
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// ConsoleSink prints info records as they are to stdout, and every other record with its level and time to stderr
+type ConsoleSink struct {
+	log *log.Logger
+}
+
+// NewConsoleSink prints the records of the logger loggerName
+func NewConsoleSink(loggerName string) *ConsoleSink {
+	return &ConsoleSink{log.New(os.Stderr, fmt.Sprintf("[%s] ", loggerName), log.Ltime|log.Lmicroseconds)}
+}
+
+func (s *ConsoleSink) Write(r Record) error {
+	if r.Level == level.INFO {
+		_, err := fmt.Println(r.Msg)
+		return err
+	}
+	s.log.Print(r)
+	return nil
+}
+
+// Close does nothing, the console stays open
+func (s *ConsoleSink) Close() error {
+	return nil
+}
+
+// RingSink keeps the last records in memory, e.g. for tests to assert on or to show recent errors
+type RingSink struct {
+	sync.Mutex
+	records []Record
+	next    int // index the next record goes to
+	full    bool
+}
+
+// NewRingSink keeps the last size records
+func NewRingSink(size int) *RingSink {
+	return &RingSink{records: make([]Record, size)}
+}
+
+func (s *RingSink) Write(r Record) error {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.records) == 0 {
+		return nil
+	}
+	s.records[s.next] = r
+	s.next = (s.next + 1) % len(s.records)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+// Records kept, the oldest first
+func (s *RingSink) Records() []Record {
+	s.Lock()
+	defer s.Unlock()
+	if !s.full {
+		return append([]Record(nil), s.records[:s.next]...)
+	}
+	return append(append([]Record(nil), s.records[s.next:]...), s.records[:s.next]...)
+}
+
+// Clear the records kept
+func (s *RingSink) Clear() {
+	s.Lock()
+	defer s.Unlock()
+	s.next = 0
+	s.full = false
+}
+
+// Close does nothing, the records stay readable
+func (s *RingSink) Close() error {
+	return nil
+}
+
+// SYSLOGFACILITY of the records sent to syslog, user-level messages
+const SYSLOGFACILITY = 1
+
+// SyslogSink sends records to a syslog server over UDP, in the BSD syslog format of RFC 3164
+type SyslogSink struct {
+	sync.Mutex
+	conn    net.Conn
+	host    string
+	tag     string
+	failing bool // a send failed and was reported, until one succeeds
+}
+
+// NewSyslogSink sends records to the syslog server at addr, e.g. 127.0.0.1:514, tagged with tag
+func NewSyslogSink(addr string, tag string) (*SyslogSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial syslog server: %s", err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "-"
+	}
+	return &SyslogSink{conn: conn, host: host, tag: tag}, nil
+}
+
+func (s *SyslogSink) Write(r Record) error {
+	msg := r.Msg
+	if len(r.Fields) > 0 {
+		msg += " | " + r.Fields.String()
+	}
+	priority := SYSLOGFACILITY*8 + syslogSeverity(r.Level)
+	packet := fmt.Sprintf("<%d>%s %s %s: %s", priority, r.Time.Format(time.Stamp), s.host, s.tag, msg)
+	s.Lock()
+	defer s.Unlock()
+	_, err := s.conn.Write([]byte(packet))
+	if err != nil && !s.failing {
+		fmt.Fprintf(os.Stderr, "syslog %s: %s\n", s.conn.RemoteAddr(), err)
+	}
+	s.failing = err != nil
+	return err
+}
+
+// Close the connection
+func (s *SyslogSink) Close() error {
+	return s.conn.Close()
+}
+
+// syslogSeverity of a level, from 0 for emergencies to 7 for debug messages
+func syslogSeverity(l level.Level) int {
+	switch l {
+	case level.FATAL:
+		return 2
+	case level.ERROR:
+		return 3
+	case level.WARNING:
+		return 4
+	case level.INFO:
+		return 6
+	default:
+		return 7
+	}
+}
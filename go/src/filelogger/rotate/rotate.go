@@ -0,0 +1,323 @@
+package rotate
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	A log file that is rotated once it is too big or too old, keeping a limited number of files.
+	The file written to keeps its name, rotated files get a sequence number appended, e.g. app<time>.log.1,
+	and .gz too when compressed. Files left by earlier runs count towards the files kept, the oldest go first.
+*/
+
+// FLUSHINTERVAL is how often buffered writes reach the file at the latest
+const FLUSHINTERVAL = time.Second
+
+// BUFFEREDWRITES is how many writes can be waiting for the file before writers block
+const BUFFEREDWRITES = 1024
+
+// Config of a rotating file. The zero Config never rotates, keeps every file and writes synchronously.
+type Config struct {
+	MaxSize  int64         // bytes after which the file is rotated, 0 for no limit
+	MaxAge   time.Duration // time after which the file is rotated, 0 for no limit
+	MaxFiles int           // files of the log kept, the one written to included, 0 to keep all
+	Compress bool          // gzip rotated files
+	Async    bool          // write from a goroutine through a buffer, flushed every FLUSHINTERVAL, by Flush and by Close
+}
+
+// Writer of a rotating file
+type Writer struct {
+	sync.Mutex
+	path      string // of the file written to
+	pattern   string // glob of every file of the log, earlier runs' included
+	config    Config
+	file      *os.File
+	buf       *bufio.Writer // over file, when async
+	size      int64
+	opened    time.Time
+	rotations int
+	failing   bool // a write failed and was reported, until one succeeds
+
+	// when async, guards closing the queue against writes still being queued, closed is guarded by the writer otherwise
+	queue   sync.RWMutex
+	closed  bool
+	writes  chan []byte
+	flushes chan chan struct{}
+	done    chan struct{}
+}
+
+// NewWriter creates the file at path, to be rotated per config.
+// pattern globs every file of the log, for the oldest to be removed when more than config.MaxFiles are kept.
+func NewWriter(path string, pattern string, config Config) (w *Writer, err error) {
+	w = &Writer{path: path, pattern: pattern, config: config}
+	if err = w.open(); err != nil {
+		return nil, err
+	}
+	w.prune()
+	if config.Async {
+		w.buf = bufio.NewWriter(w.file)
+		w.writes = make(chan []byte, BUFFEREDWRITES)
+		w.flushes = make(chan chan struct{})
+		w.done = make(chan struct{})
+		go w.writeAsync()
+	}
+	return w, nil
+}
+
+// Path of the file written to
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Write p to the file, rotating it first if due. When async, p is only queued.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.config.Async {
+		w.queue.RLock()
+		defer w.queue.RUnlock()
+		if w.closed {
+			return 0, os.ErrClosed
+		}
+		w.writes <- append([]byte(nil), p...)
+		return len(p), nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	return w.write(p)
+}
+
+// Flush every write queued to the file
+func (w *Writer) Flush() error {
+	if !w.config.Async {
+		return nil
+	}
+	w.queue.RLock()
+	defer w.queue.RUnlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	flushed := make(chan struct{})
+	w.flushes <- flushed
+	<-flushed
+	return nil
+}
+
+// Close the file, after flushing every write queued. Later writes fail.
+func (w *Writer) Close() error {
+	if w.config.Async {
+		w.queue.Lock()
+		if w.closed {
+			w.queue.Unlock()
+			return os.ErrClosed
+		}
+		w.closed = true
+		close(w.writes)
+		w.queue.Unlock()
+		<-w.done
+	}
+	w.Lock()
+	defer w.Unlock()
+	if !w.config.Async {
+		if w.closed {
+			return os.ErrClosed
+		}
+		w.closed = true
+	}
+	return w.file.Close()
+}
+
+// writeAsync writes what is queued until the writer is closed
+func (w *Writer) writeAsync() {
+	defer close(w.done)
+	ticker := time.NewTicker(FLUSHINTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case p, ok := <-w.writes:
+			if !ok {
+				w.flushBuffer()
+				return
+			}
+			w.Lock()
+			w.write(p)
+			w.Unlock()
+		case flushed := <-w.flushes:
+			// writes queued before the flush are written first
+			for queued := len(w.writes); queued > 0; queued-- {
+				p := <-w.writes
+				w.Lock()
+				w.write(p)
+				w.Unlock()
+			}
+			w.flushBuffer()
+			close(flushed)
+		case <-ticker.C:
+			w.flushBuffer()
+		}
+	}
+}
+
+func (w *Writer) flushBuffer() {
+	w.Lock()
+	defer w.Unlock()
+	w.report(w.buf.Flush())
+}
+
+// write p, the writer must be locked
+func (w *Writer) write(p []byte) (n int, err error) {
+	if w.due(len(p)) {
+		w.report(w.rotate())
+	}
+	if w.buf != nil {
+		n, err = w.buf.Write(p)
+	} else {
+		n, err = w.file.Write(p)
+	}
+	w.size += int64(n)
+	w.report(err)
+	return n, err
+}
+
+// due is true when the file has to be rotated before writing n more bytes to it
+func (w *Writer) due(n int) bool {
+	if w.size == 0 {
+		// never rotate to an empty file, a single write too big for a file still goes somewhere
+		return false
+	}
+	if w.config.MaxSize > 0 && w.size+int64(n) > w.config.MaxSize {
+		return true
+	}
+	return w.config.MaxAge > 0 && time.Since(w.opened) >= w.config.MaxAge
+}
+
+// rotate moves the file aside and starts a new one at the same path, the writer must be locked
+func (w *Writer) rotate() (err error) {
+	if w.buf != nil {
+		if err = w.buf.Flush(); err != nil {
+			return err
+		}
+	}
+	if err = w.file.Close(); err != nil {
+		return err
+	}
+	// a process started in the same second shares the path, and may have rotated it too
+	rotated := ""
+	for rotated == "" || exists(rotated) || exists(rotated+".gz") {
+		w.rotations++
+		rotated = fmt.Sprintf("%s.%d", w.path, w.rotations)
+	}
+	if err = os.Rename(w.path, rotated); err != nil {
+		return err
+	}
+	if err = w.open(); err != nil {
+		return err
+	}
+	if w.buf != nil {
+		w.buf.Reset(w.file)
+	}
+	if w.config.Compress {
+		if err = compress(rotated); err != nil {
+			return err
+		}
+	}
+	w.prune()
+	return nil
+}
+
+// open the file at path, appending to it, as processes started in the same second share the name of their log
+func (w *Writer) open() (err error) {
+	w.file, err = os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create log file: %s", err)
+	}
+	info, err := w.file.Stat()
+	if err != nil {
+		w.file.Close()
+		return fmt.Errorf("unable to create log file: %s", err)
+	}
+	w.size = info.Size()
+	w.opened = time.Now()
+	return nil
+}
+
+// prune removes the oldest files of the log until config.MaxFiles are left
+func (w *Writer) prune() {
+	if w.config.MaxFiles <= 0 {
+		return
+	}
+	paths, err := filepath.Glob(w.pattern)
+	if err != nil {
+		w.report(err)
+		return
+	}
+	type old struct {
+		path     string
+		modified time.Time
+	}
+	var files []old
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || path == w.path {
+			continue
+		}
+		files = append(files, old{path, info.ModTime()})
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modified.Before(files[j].modified) })
+	// the file written to is kept too
+	for len(files)+1 > w.config.MaxFiles {
+		w.report(os.Remove(files[0].path))
+		files = files[1:]
+	}
+}
+
+// report a write error to stderr, once until writing succeeds again, as the log itself may be what is failing
+func (w *Writer) report(err error) {
+	if err == nil {
+		w.failing = false
+		return
+	}
+	if !w.failing {
+		fmt.Fprintf(os.Stderr, "log %s: %s\n", w.path, err)
+	}
+	w.failing = true
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// compress replaces the file at path with path.gz
+func compress(path string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zipped := gzip.NewWriter(out)
+	if _, err = io.Copy(zipped, in); err == nil {
+		err = zipped.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
@@ -3,6 +3,7 @@ package singletonlogger
 import (
 	"filelogger/level"
 	"filelogger/logger"
+	"filelogger/rotate"
 	"filelogger/state"
 	"fmt"
 )
@@ -21,6 +22,61 @@ func NewSingletonLogger(loggerName string, state state.State) (err error) {
 	return nil
 }
 
+// NewRotatingSingletonLogger creates a new global single instance of a logger, rotating its files per rotation.
+func NewRotatingSingletonLogger(loggerName string, state state.State, rotation rotate.Config) (err error) {
+	if singletonLogger != nil {
+		return fmt.Errorf("logger already exists")
+	}
+	singletonLogger, err = logger.NewRotatingFileLogger(loggerName, state, rotation)
+	if err != nil {
+		return fmt.Errorf("unable to create a singletonlogger: %s", err)
+	}
+	return nil
+}
+
+// Get the logger, nil until it is created, e.g. to give to a component that takes a *logger.Logger
+func Get() *logger.Logger {
+	return singletonLogger
+}
+
+// Exit the logger, writing out what is buffered. Call it before os.Exit, which skips deferred calls.
+func Exit() {
+	if singletonLogger == nil {
+		return
+	}
+	singletonLogger.Exit()
+}
+
+// EnableJSON also writes every entry, with its fields, to a JSON lines file in logs/
+func EnableJSON() error {
+	if singletonLogger == nil {
+		return fmt.Errorf("logger uninitialised")
+	}
+	return singletonLogger.EnableJSON()
+}
+
+// AddSink makes the logger also write the records at min or above to sink
+func AddSink(sink logger.Sink, min level.Level) error {
+	if singletonLogger == nil {
+		return fmt.Errorf("logger uninitialised")
+	}
+	singletonLogger.AddSink(sink, min)
+	return nil
+}
+
+// RemoveSink stops the logger writing to sink, without closing it
+func RemoveSink(sink logger.Sink) {
+	if singletonLogger == nil {
+		return
+	}
+	singletonLogger.RemoveSink(sink)
+}
+
+// With starts an entry carrying fields, e.g. With(logger.Fields{logger.NODE: addr}).Debug("joined")
+func With(fields logger.Fields) *logger.Entry {
+	return singletonLogger.With(fields)
+}
+
 // Debug Level log
 func Debug(data string) {
 	if singletonLogger == nil {
@@ -70,3 +126,64 @@ func Fatal(data string) {
 	}
 	singletonLogger.Log(level.FATAL, data)
 }
+
+// Debugf Level log, formatted only if debug messages are logged
+func Debugf(format string, args ...interface{}) {
+	logf(level.DEBUG, format, args...)
+}
+
+// Infof Level log, formatted only if info messages are logged
+func Infof(format string, args ...interface{}) {
+	logf(level.INFO, format, args...)
+}
+
+// Warnf Level log, formatted only if warnings are logged
+func Warnf(format string, args ...interface{}) {
+	logf(level.WARNING, format, args...)
+}
+
+// Errorf Level log, formatted only if errors are logged
+func Errorf(format string, args ...interface{}) {
+	logf(level.ERROR, format, args...)
+}
+
+// Fatalf Level log, formatted only if fatal messages are logged
+func Fatalf(format string, args ...interface{}) {
+	logf(level.FATAL, format, args...)
+}
+
+func logf(givenLevel level.Level, format string, args ...interface{}) {
+	if singletonLogger == nil {
+		fmt.Println("LOGGING ERROR: Singleton logger uninitialised!")
+		fmt.Printf(format+"\n", args...)
+		return
+	}
+	singletonLogger.Logf(givenLevel, format, args...)
+}
+
+// SetLevel drops the messages of component, e.g. "[paxosnode]", less severe than min.
+// The component logger.DEFAULT sets the level of every component without its own.
+func SetLevel(component string, min level.Level) error {
+	if singletonLogger == nil {
+		return fmt.Errorf("logger uninitialised")
+	}
+	singletonLogger.SetLevel(component, min)
+	return nil
+}
+
+// ResetLevel makes component use the default level again
+func ResetLevel(component string) error {
+	if singletonLogger == nil {
+		return fmt.Errorf("logger uninitialised")
+	}
+	singletonLogger.ResetLevel(component)
+	return nil
+}
+
+// Levels lists the levels set per component
+func Levels() []string {
+	if singletonLogger == nil {
+		return nil
+	}
+	return singletonLogger.Levels()
+}
@@ -0,0 +1,168 @@
+package vclock
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"net"
+	"net/rpc"
+)
+
+/*
+	RPC codecs carrying a vector clock after every request and response, like net/rpc's gob codecs otherwise.
+	Both ends of a connection must use them. A process without a Logger sends empty clocks and ignores the ones it
+	receives, so processes logging vector clocks and processes not doing so can still talk to each other.
+	Only the method of a message is logged, never its body, which may carry join tokens and other secrets.
+*/
+
+// stamp carries the clock on the wire, a struct so that an empty clock encodes too
+type stamp struct {
+	Clock VClock
+}
+
+// NewClient creates an RPC client over conn that sends and receives clocks for l
+func NewClient(conn io.ReadWriteCloser, l *Logger) *rpc.Client {
+	buf := bufio.NewWriter(conn)
+	return rpc.NewClientWithCodec(&clientCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+		log:    l,
+		peer:   peerOf(conn),
+	})
+}
+
+// ServeConn serves server's RPCs on conn, sending and receiving clocks for l. It blocks until the client hangs up.
+func ServeConn(server *rpc.Server, conn io.ReadWriteCloser, l *Logger) {
+	buf := bufio.NewWriter(conn)
+	server.ServeCodec(&serverCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+		log:    l,
+		peer:   peerOf(conn),
+	})
+}
+
+type clientCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	log    *Logger
+	peer   string
+	method string // of the response being read
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) (err error) {
+	clock := c.log.Send(r.ServiceMethod, "send %s to %s", r.ServiceMethod, c.peer)
+	if err = c.enc.Encode(r); err != nil {
+		return err
+	}
+	if err = c.enc.Encode(body); err != nil {
+		return err
+	}
+	if err = c.enc.Encode(stamp{clock}); err != nil {
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	if err := c.dec.Decode(r); err != nil {
+		return err
+	}
+	c.method = r.ServiceMethod
+	return nil
+}
+
+// ReadResponseBody is called with a nil body for responses nobody waits for, their value is still read off the wire
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	if err := c.dec.Decode(body); err != nil {
+		return err
+	}
+	var s stamp
+	if err := c.dec.Decode(&s); err != nil {
+		return err
+	}
+	c.log.Receive(c.method, s.Clock, "receive reply to %s from %s", c.method, c.peer)
+	return nil
+}
+
+func (c *clientCodec) Close() error {
+	return c.rwc.Close()
+}
+
+type serverCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	log    *Logger
+	peer   string
+	method string // of the request being read
+	closed bool
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.dec.Decode(r); err != nil {
+		return err
+	}
+	c.method = r.ServiceMethod
+	return nil
+}
+
+// ReadRequestBody is called with a nil body for unknown methods, their value is still read off the wire
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	if err := c.dec.Decode(body); err != nil {
+		return err
+	}
+	var s stamp
+	if err := c.dec.Decode(&s); err != nil {
+		return err
+	}
+	c.log.Receive(c.method, s.Clock, "receive %s from %s", c.method, c.peer)
+	return nil
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	clock := c.log.Send(r.ServiceMethod, "reply to %s from %s", r.ServiceMethod, c.peer)
+	// like net/rpc, a response that cannot be encoded closes the connection, as the stream is broken
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	if err = c.enc.Encode(stamp{clock}); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *serverCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
+
+// peerOf names the other end of conn for the log, when conn is a network connection
+func peerOf(conn io.ReadWriteCloser) string {
+	if nc, ok := conn.(net.Conn); ok {
+		return nc.RemoteAddr().String()
+	}
+	return "peer"
+}
@@ -0,0 +1,166 @@
+package vclock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Vector clock logging, for lining up the events of every process of a run.
+	Each process writes its own logs/<name>_<process>_<time>.shiviz.log next to its plain text log.
+	Every event takes two lines, the process and its vector clock, then what happened:
+
+		127.0.0.1:2001 {"127.0.0.1:2001":3,"127.0.0.1:2002":1}
+		receive PaxosNodeRPCWrapper.ProcessPrepareRequest
+
+	Concatenate the files of every process and load them into ShiViz with the parser regex SHIVIZREGEX.
+	The clocks ride along on RPCs through the codecs in codec.go.
+*/
+
+// SHIVIZREGEX parses the events of a vector clock log in ShiViz
+const SHIVIZREGEX = `(?<host>\S*) (?<clock>{.*})\n(?<event>.*)`
+
+// VClock maps each process to the number of its events known of
+type VClock map[string]uint64
+
+// Copy the clock, so it can be sent while the original keeps ticking
+func (vc VClock) Copy() VClock {
+	copied := make(VClock, len(vc))
+	for process, ticks := range vc {
+		copied[process] = ticks
+	}
+	return copied
+}
+
+// Merge other into the clock, keeping the latest of each process
+func (vc VClock) Merge(other VClock) {
+	for process, ticks := range other {
+		if ticks > vc[process] {
+			vc[process] = ticks
+		}
+	}
+}
+
+func (vc VClock) String() string {
+	// maps are marshalled with sorted keys, so equal clocks print the same
+	out, _ := json.Marshal(map[string]uint64(vc))
+	return string(out)
+}
+
+// Logger keeps the vector clock of one process and logs its events. A nil Logger logs nothing and sends empty clocks.
+type Logger struct {
+	sync.Mutex
+	process string
+	clock   VClock
+	ignored map[string]bool
+	file    *os.File
+}
+
+// NewLogger creates the vector clock log of process, named after loggerName like its plain text log
+func NewLogger(loggerName string, process string) (l *Logger, err error) {
+	err = os.MkdirAll("logs", 0700)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create log folder: %s", err)
+	}
+	name := fmt.Sprintf("logs/%s_%s_%s.shiviz.log", loggerName, strings.Replace(process, ":", "-", -1), timeNow())
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create vector clock log file: %s", err)
+	}
+	l = &Logger{
+		process: process,
+		clock:   VClock{},
+		ignored: make(map[string]bool),
+		file:    f,
+	}
+	l.LocalEvent("Initialization complete")
+	return l, nil
+}
+
+// Ignore keeps the RPCs to methods, e.g. heartbeats, out of the log. Their clocks are neither sent nor merged.
+func (l *Logger) Ignore(methods ...string) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	for _, method := range methods {
+		l.ignored[method] = true
+	}
+}
+
+// LocalEvent logs an event of the process that involves no other process
+func (l *Logger) LocalEvent(event string) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.tick(event)
+}
+
+// Send logs a message leaving the process for method, described by format and args, returning the clock to send with it
+func (l *Logger) Send(method string, format string, args ...interface{}) VClock {
+	if l == nil {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.ignored[method] {
+		return nil
+	}
+	l.tick(fmt.Sprintf(format, args...))
+	return l.clock.Copy()
+}
+
+// Receive logs a message for method arriving with clock, described by format and args
+func (l *Logger) Receive(method string, clock VClock, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.ignored[method] {
+		return
+	}
+	l.clock.Merge(clock)
+	l.tick(fmt.Sprintf(format, args...))
+}
+
+// Clock of the process, a copy. A nil Logger has an empty clock.
+func (l *Logger) Clock() VClock {
+	if l == nil {
+		return VClock{}
+	}
+	l.Lock()
+	defer l.Unlock()
+	return l.clock.Copy()
+}
+
+// Close the log
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	return l.file.Close()
+}
+
+// tick advances the process' own entry and writes the event, with the lock held
+func (l *Logger) tick(event string) {
+	l.clock[l.process]++
+	event = strings.Replace(event, "\n", " ", -1)
+	_, err := fmt.Fprintf(l.file, "%s %s\n%s\n", l.process, l.clock, event)
+	if err != nil {
+		fmt.Printf("vector clock write failed: %s\n", err)
+	}
+}
+
+func timeNow() string {
+	return time.Now().Format("2006-01-02_15:04:05")
+}
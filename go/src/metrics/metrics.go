@@ -0,0 +1,340 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Metrics in the Prometheus text exposition format, version 0.0.4, built on the standard library alone so that they
+work offline. Counters, gauges and histograms are registered on a Registry, which serves them at /metrics:
+
+	# HELP paxos_nacks_total Replies refusing this node's requests.
+	# TYPE paxos_nacks_total counter
+	paxos_nacks_total{phase="accept"} 0
+	paxos_nacks_total{phase="prepare"} 2
+
+Registering a metric again with the same name and labels returns the one registered first.
+A nil metric ignores updates, so components without a registry need not check for one.
+*/
+
+// CONTENTTYPE of the text exposition format
+const CONTENTTYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// PATH metrics are served at
+const PATH = "/metrics"
+
+// LATENCYBUCKETS are the upper bounds, in seconds, of the buckets of latency histograms
+var LATENCYBUCKETS = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Labels of a metric, e.g. Labels{"phase": "prepare"}
+type Labels map[string]string
+
+// String as in the exposition format, sorted by name, e.g. {phase="prepare"}, empty without labels
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%s", name, strconv.Quote(l[name]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// with the labels and one more, for histogram buckets
+func (l Labels) with(name string, value string) Labels {
+	more := Labels{name: value}
+	for k, v := range l {
+		more[k] = v
+	}
+	return more
+}
+
+// Kind of metric, as in # TYPE lines
+type Kind string
+
+const (
+	// COUNTER only goes up
+	COUNTER Kind = "counter"
+	// GAUGE goes up and down
+	GAUGE Kind = "gauge"
+	// HISTOGRAM counts observations per bucket
+	HISTOGRAM Kind = "histogram"
+)
+
+// Registry of the metrics of one process or node
+type Registry struct {
+	sync.Mutex
+	families map[string]*family
+}
+
+// family is every series of a metric name
+type family struct {
+	help   string
+	kind   Kind
+	series map[string]series // by labels
+}
+
+type series interface {
+	write(w io.Writer, name string) error
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// register s as the series of name with labels, or return the one registered before
+func (r *Registry) register(name string, help string, kind Kind, labels Labels, s series) series {
+	r.Lock()
+	defer r.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{help: help, kind: kind, series: make(map[string]series)}
+		r.families[name] = f
+	}
+	if f.kind != kind {
+		panic(fmt.Sprintf("metric %s registered as a %s and a %s", name, f.kind, kind))
+	}
+	if registered, ok := f.series[labels.String()]; ok {
+		return registered
+	}
+	f.series[labels.String()] = s
+	return s
+}
+
+// Counter registers a counter
+func (r *Registry) Counter(name string, help string, labels Labels) *Counter {
+	return r.register(name, help, COUNTER, labels, &Counter{labels: labels}).(*Counter)
+}
+
+// Gauge registers a gauge that is set
+func (r *Registry) Gauge(name string, help string, labels Labels) *Gauge {
+	return r.register(name, help, GAUGE, labels, &Gauge{labels: labels}).(*Gauge)
+}
+
+// GaugeFunc registers a gauge whose value is read from value on every scrape. value must not block.
+func (r *Registry) GaugeFunc(name string, help string, labels Labels, value func() float64) {
+	r.register(name, help, GAUGE, labels, gaugeFunc{labels, value})
+}
+
+// Histogram registers a histogram with the given bucket upper bounds, in increasing order
+func (r *Registry) Histogram(name string, help string, labels Labels, buckets []float64) *Histogram {
+	h := &Histogram{labels: labels, buckets: buckets, counts: make([]uint64, len(buckets))}
+	return r.register(name, help, HISTOGRAM, labels, h).(*Histogram)
+}
+
+// Write every metric to w in the exposition format, sorted by name then labels
+func (r *Registry) Write(w io.Writer) error {
+	r.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	type labelled struct {
+		labels string
+		series series
+	}
+	families := make([]*family, len(names))
+	all := make([][]labelled, len(names))
+	for i, name := range names {
+		families[i] = r.families[name]
+		for labels, s := range families[i].series {
+			all[i] = append(all[i], labelled{labels, s})
+		}
+		sort.Slice(all[i], func(a, b int) bool { return all[i][a].labels < all[i][b].labels })
+	}
+	r.Unlock()
+
+	for i, name := range names {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(families[i].help), name, families[i].kind)
+		if err != nil {
+			return err
+		}
+		for _, l := range all[i] {
+			if err = l.series.write(w, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP writes every metric, so a Registry can be served at PATH
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", CONTENTTYPE)
+	r.Write(w)
+}
+
+// Serve the metrics of r at PATH on addr, e.g. ":9100", in the background.
+// The listener is returned for its address, and to stop serving by closing it.
+func Serve(addr string, r *Registry) (listener net.Listener, err error) {
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for metrics on %s: %s", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(PATH, r)
+	go http.Serve(listener, mux)
+	return listener, nil
+}
+
+// Counter of events
+type Counter struct {
+	value  uint64 // first, for 64 bit atomic access on 32 bit platforms
+	labels Labels
+}
+
+// Inc adds one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add n
+func (c *Counter) Add(n uint64) {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value counted so far
+func (c *Counter) Value() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.value)
+}
+
+func (c *Counter) write(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "%s%s %d\n", name, c.labels, c.Value())
+	return err
+}
+
+// Gauge of a value that goes up and down
+type Gauge struct {
+	bits   uint64 // of the float64 value, first for 64 bit atomic access on 32 bit platforms
+	labels Labels
+}
+
+// Set the value
+func (g *Gauge) Set(v float64) {
+	if g == nil {
+		return
+	}
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Value set last
+func (g *Gauge) Value() float64 {
+	if g == nil {
+		return 0
+	}
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) write(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "%s%s %s\n", name, g.labels, formatFloat(g.Value()))
+	return err
+}
+
+type gaugeFunc struct {
+	labels Labels
+	value  func() float64
+}
+
+func (g gaugeFunc) write(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "%s%s %s\n", name, g.labels, formatFloat(g.value()))
+	return err
+}
+
+// Histogram of observations, counted in buckets by upper bound
+type Histogram struct {
+	sync.Mutex
+	labels  Labels
+	buckets []float64
+	counts  []uint64 // of observations in each bucket alone, made cumulative when written
+	sum     float64
+	count   uint64
+}
+
+// Observe v
+func (h *Histogram) Observe(v float64) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ObserveSince observes the seconds since start
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count of observations
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+	h.Lock()
+	defer h.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer, name string) error {
+	h.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.Unlock()
+	cumulative := uint64(0)
+	for i, bound := range h.buckets {
+		cumulative += counts[i]
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.labels.with("le", formatFloat(bound)), cumulative)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+		name, h.labels.with("le", "+Inf"), count, name, h.labels, formatFloat(sum), name, h.labels, count)
+	return err
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeHelp as the exposition format asks, backslashes and line feeds
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
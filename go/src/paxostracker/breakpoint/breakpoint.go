@@ -0,0 +1,206 @@
+package breakpoint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+Breakpoints pause (or kill) a node when it reaches a stage of paxos, optionally only when the round, the proposal ID,
+the value or the peer the message came from match.
+A breakpoint fires once and is then disarmed, unless it is created with Always.
+
+Conditions are written after the stage, in any order:
+	round N      only in round (slot) N
+	above N      only for proposal IDs above N
+	value TEXT   only when the value contains TEXT
+	peer ADDR    only for messages from the node at ADDR
+	always       stay armed after firing
+*/
+
+// Stage of paxos a breakpoint can be set at
+type Stage string
+
+const (
+	// Active stages, reached while this node proposes
+
+	// Prepare is before disseminating a prepare request
+	Prepare Stage = "prepare"
+	// Propose is before disseminating an accept request
+	Propose Stage = "propose"
+	// Learn is before learning a value
+	Learn Stage = "learn"
+	// Idle is before finishing a round
+	Idle Stage = "idle"
+	// Custom is a pause point that can be placed anywhere
+	Custom Stage = "custom"
+	// Reply is after counting a neighbour's reply to a prepare or accept request, ctx.Peer is the neighbour
+	Reply Stage = "reply"
+
+	// Passive stages, reached while this node's acceptor answers a proposer
+
+	// Promise is before recording a promise
+	Promise Stage = "promise"
+	// Accept is before recording an acceptance
+	Accept Stage = "accept"
+	// Notify is after the learner counted a notice that an acceptor accepted, before it learns from it.
+	// ctx.Peer is the acceptor, the node itself for its own acceptor.
+	Notify Stage = "notify"
+)
+
+// Stages are all stages, in the order a round reaches them
+var Stages = []Stage{Prepare, Promise, Reply, Propose, Accept, Notify, Learn, Idle, Custom}
+
+// next are the stages a step from each stage stops at, whichever is reached first
+var next = map[Stage][]Stage{
+	Prepare: {Reply, Propose},
+	Promise: {Accept},
+	Reply:   {Reply, Propose, Notify, Learn},
+	Propose: {Reply, Notify, Learn},
+	Accept:  {Notify, Learn},
+	Notify:  {Notify, Learn},
+	Learn:   {Idle},
+}
+
+// Next are the stages after s that a step stops at, whichever is reached first. None when s is the last stage of a round.
+func (s Stage) Next() []Stage {
+	return next[s]
+}
+
+// Join lists stages as alternatives, e.g. "reply or propose"
+func Join(stages []Stage) string {
+	words := make([]string, len(stages))
+	for i, stage := range stages {
+		words[i] = string(stage)
+	}
+	return strings.Join(words, " or ")
+}
+
+// Context describes where a node is when it reaches a stage
+type Context struct {
+	Stage Stage
+	Round int
+	ID    uint64 // proposal ID, 0 when not known yet
+	Value string
+	Peer  string // node the message came from, the node itself for its own proposals
+	Votes int    // at reply and notify, the promises, accepts or notices counted so far in favour
+	Of    int    // at reply and notify, the number of nodes votes are counted from
+}
+
+// Breakpoint pauses or kills a node at a stage when all of its conditions hold
+type Breakpoint struct {
+	ID            int
+	Stage         Stage
+	Kill          bool
+	Always        bool
+	Round         *int   // nil for any round
+	AboveID       uint64 // 0 for any proposal ID
+	ValueContains string
+	Peer          string
+	Hits          int
+	Step          int // ID of the first breakpoint armed by the same step, 0 when not armed by a step
+}
+
+// Parse a breakpoint from a stage followed by conditions, e.g. "prepare round 3 value foo"
+func Parse(words []string) (b Breakpoint, err error) {
+	if len(words) == 0 {
+		return b, fmt.Errorf("missing stage")
+	}
+	b.Stage = Stage(words[0])
+	if !b.Stage.Valid() {
+		return b, fmt.Errorf("unknown stage '%s'", words[0])
+	}
+	for i := 1; i < len(words); i++ {
+		if words[i] == "always" {
+			b.Always = true
+			continue
+		}
+		if i+1 >= len(words) {
+			return b, fmt.Errorf("missing argument to '%s'", words[i])
+		}
+		arg := words[i+1]
+		switch words[i] {
+		case "round":
+			round, err := strconv.Atoi(arg)
+			if err != nil {
+				return b, fmt.Errorf("bad round '%s'", arg)
+			}
+			b.Round = &round
+		case "above":
+			b.AboveID, err = strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return b, fmt.Errorf("bad proposal ID '%s'", arg)
+			}
+		case "value":
+			b.ValueContains = arg
+		case "peer":
+			b.Peer = arg
+		default:
+			return b, fmt.Errorf("unknown condition '%s'", words[i])
+		}
+		i++
+	}
+	return b, nil
+}
+
+// Valid is true for the known stages
+func (s Stage) Valid() bool {
+	for _, stage := range Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches is true when ctx is at the breakpoint's stage and meets all of its conditions
+func (b *Breakpoint) Matches(ctx Context) bool {
+	switch {
+	case ctx.Stage != b.Stage:
+		return false
+	case b.Round != nil && ctx.Round != *b.Round:
+		return false
+	case b.AboveID != 0 && ctx.ID <= b.AboveID:
+		return false
+	case b.ValueContains != "" && !strings.Contains(ctx.Value, b.ValueContains):
+		return false
+	case b.Peer != "" && ctx.Peer != b.Peer:
+		return false
+	}
+	return true
+}
+
+func (b Breakpoint) String() string {
+	action := "break"
+	if b.Kill {
+		action = "kill"
+	}
+	desc := fmt.Sprintf("%d: %s %s", b.ID, action, b.Stage)
+	if b.Round != nil {
+		desc += fmt.Sprintf(" round %d", *b.Round)
+	}
+	if b.AboveID != 0 {
+		desc += fmt.Sprintf(" above %d", b.AboveID)
+	}
+	if b.ValueContains != "" {
+		desc += " value " + b.ValueContains
+	}
+	if b.Peer != "" {
+		desc += " peer " + b.Peer
+	}
+	if b.Always {
+		desc += fmt.Sprintf(" always (hit %d times)", b.Hits)
+	}
+	if b.Step != 0 {
+		desc += " (step)"
+	}
+	return desc
+}
+
+func (c Context) String() string {
+	if c.Of != 0 {
+		return fmt.Sprintf("%s in round %d (proposal %d, value '%s', from %s, %d of %d in favour)", c.Stage, c.Round, c.ID, c.Value, c.Peer, c.Votes, c.Of)
+	}
+	return fmt.Sprintf("%s in round %d (proposal %d, value '%s', from %s)", c.Stage, c.Round, c.ID, c.Value, c.Peer)
+}
@@ -0,0 +1,141 @@
+package paxostracker
+
+import (
+	"os"
+	"paxostracker/breakpoint"
+	"paxostracker/errors"
+)
+
+// Break arms b, returning the ID it can be deleted by
+func (t *PaxosTracker) Break(b breakpoint.Breakpoint) int {
+	t.breakLock.Lock()
+	defer t.breakLock.Unlock()
+	b.ID = t.nextBreakpoint
+	b.Hits = 0
+	t.nextBreakpoint++
+	t.breakpoints = append(t.breakpoints, b)
+	t.logger.Debugf("[paxostracker] armed breakpoint %v", b)
+	return b.ID
+}
+
+// Breakpoints returns the armed breakpoints, in the order they were armed
+func (t *PaxosTracker) Breakpoints() []breakpoint.Breakpoint {
+	t.breakLock.Lock()
+	defer t.breakLock.Unlock()
+	return append([]breakpoint.Breakpoint(nil), t.breakpoints...)
+}
+
+// Delete disarms the breakpoint with the given ID
+func (t *PaxosTracker) Delete(id int) error {
+	t.breakLock.Lock()
+	defer t.breakLock.Unlock()
+	for i, b := range t.breakpoints {
+		if b.ID == id {
+			t.breakpoints = append(t.breakpoints[:i], t.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return errors.UnknownBreakpoint(id)
+}
+
+// Paused returns where this node is paused at a breakpoint, if anywhere.
+// Several stages can be paused at once, e.g. an acceptor answering while the proposer waits.
+func (t *PaxosTracker) Paused() []breakpoint.Context {
+	t.breakLock.Lock()
+	defer t.breakLock.Unlock()
+	return append([]breakpoint.Context(nil), t.paused...)
+}
+
+// Continue the execution of paxos at every paused stage
+func (t *PaxosTracker) Continue() error {
+	t.breakLock.Lock()
+	defer t.breakLock.Unlock()
+	if len(t.paused) == 0 {
+		return errors.NotPaused("")
+	}
+	t.logger.Debug("[paxostracker] continuing paused stages")
+	close(t.continuePaxos)
+	t.continuePaxos = make(chan struct{})
+	t.paused = nil
+	return nil
+}
+
+// Step continues every paused stage, breaking again at whichever of the stages after it is reached first.
+// It returns the stages that may be broken at, stages at the end of a round are just continued.
+func (t *PaxosTracker) Step() (next []breakpoint.Stage, err error) {
+	armed := make(map[breakpoint.Stage]bool)
+	for _, ctx := range t.Paused() {
+		stages := ctx.Stage.Next()
+		if len(stages) == 0 {
+			continue
+		}
+		t.breakAny(stages)
+		for _, stage := range stages {
+			if !armed[stage] {
+				armed[stage] = true
+				next = append(next, stage)
+			}
+		}
+	}
+	return next, t.Continue()
+}
+
+// breakAny arms a breakpoint at each of stages, all of which are disarmed once one of them fires
+func (t *PaxosTracker) breakAny(stages []breakpoint.Stage) {
+	t.breakLock.Lock()
+	defer t.breakLock.Unlock()
+	step := t.nextBreakpoint
+	for _, stage := range stages {
+		b := breakpoint.Breakpoint{ID: t.nextBreakpoint, Stage: stage, Step: step}
+		t.nextBreakpoint++
+		t.breakpoints = append(t.breakpoints, b)
+		t.logger.Debugf("[paxostracker] armed breakpoint %v", b)
+	}
+}
+
+// checkpoint pauses or kills the node if an armed breakpoint matches ctx at stage.
+// It must be called without holding the tracker's lock, so the tracker can be inspected while paused.
+func (t *PaxosTracker) checkpoint(stage breakpoint.Stage, ctx breakpoint.Context) {
+	ctx.Stage = stage
+	t.breakLock.Lock()
+	var hit *breakpoint.Breakpoint
+	for i := range t.breakpoints {
+		if t.breakpoints[i].Matches(ctx) {
+			t.breakpoints[i].Hits++
+			b := t.breakpoints[i]
+			hit = &b
+			if !b.Always {
+				t.breakpoints = append(t.breakpoints[:i], t.breakpoints[i+1:]...)
+			}
+			break
+		}
+	}
+	if hit != nil && hit.Step != 0 {
+		// the other stages the step could have stopped at are not waited for anymore
+		armed := t.breakpoints[:0]
+		for _, b := range t.breakpoints {
+			if b.Step != hit.Step {
+				armed = append(armed, b)
+			}
+		}
+		t.breakpoints = armed
+	}
+	if hit == nil {
+		t.breakLock.Unlock()
+		return
+	}
+	if hit.Kill {
+		t.logger.Debugf("[paxostracker] killing roughly at %v, breakpoint %v", ctx, hit)
+		// only the log is written out, nothing else gets to finish
+		t.logger.Exit()
+		os.Exit(1)
+	}
+	t.paused = append(t.paused, ctx)
+	resume := t.continuePaxos
+	t.breakLock.Unlock()
+
+	t.logger.Infof("[paxostracker] blocking before %v, breakpoint %v", ctx, hit)
+	// blocks until continue
+	<-resume
+	t.logger.Debugf("[paxostracker] continuing from %v...", ctx)
+}
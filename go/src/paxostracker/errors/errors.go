@@ -1,5 +1,7 @@
 package errors
 
+import "fmt"
+
 type BadTransition string
 
 func (e BadTransition) Error() string {
@@ -11,3 +13,21 @@ type UnknownTransition string
 func (e UnknownTransition) Error() string {
 	return "unknown transition"
 }
+
+type UnknownBreakpoint int
+
+func (e UnknownBreakpoint) Error() string {
+	return fmt.Sprintf("unknown breakpoint %d", int(e))
+}
+
+type NotPaused string
+
+func (e NotPaused) Error() string {
+	return "not paused at a breakpoint"
+}
+
+type Uninitialised string
+
+func (e Uninitialised) Error() string {
+	return fmt.Sprintf("PaxosTracker uninitialised, unable to track %s", string(e))
+}
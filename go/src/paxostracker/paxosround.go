@@ -2,21 +2,58 @@ package paxostracker
 
 import (
 	"fmt"
+	"paxostracker/state"
+	"strings"
+	"time"
 )
 
 // PaxosRound is a round of paxos
 type PaxosRound struct {
+	Round               int
 	InitialAddr         string
 	AcceptedPreparation uint64
 	AcceptedProposal    uint64
 	Value               string
 	ErrorReason         string
+	Started             time.Time                          // when this node entered the round
+	Durations           map[state.PaxosState]time.Duration // time this node spent in each state of the round
+	Votes
+}
+
+// Votes are the nodes seen to promise, accept and learn in a round
+type Votes struct {
+	Promised []string
+	Accepted []string
+	Learned  []string
 }
 
 // AsRow converts a round to a string row
 func (r *PaxosRound) AsRow() string {
 	if r.ErrorReason != "" {
-		return fmt.Sprintf("| %s |", r.ErrorReason)
+		return fmt.Sprintf("| %d | %s |\n", r.Round, r.ErrorReason)
+	}
+	return fmt.Sprintf("| %d | %s | %d | %d | %s | %s | %s | %s |\n", r.Round, r.InitialAddr, r.AcceptedPreparation, r.AcceptedProposal, r.Value,
+		asCell(r.Promised), asCell(r.Accepted), asCell(r.Learned))
+}
+
+func asCell(addrs []string) string {
+	if len(addrs) == 0 {
+		return "-"
+	}
+	return strings.Join(addrs, " ")
+}
+
+// add addr to the sorted set addrs
+func addVote(addrs []string, addr string) []string {
+	i := 0
+	for i < len(addrs) && addrs[i] < addr {
+		i++
+	}
+	if i < len(addrs) && addrs[i] == addr {
+		return addrs
 	}
-	return fmt.Sprintf("| %s | %d | %d | %s |\n", r.InitialAddr, r.AcceptedPreparation, r.AcceptedProposal, r.Value)
+	addrs = append(addrs, "")
+	copy(addrs[i+1:], addrs[i:])
+	addrs[i] = addr
+	return addrs
 }
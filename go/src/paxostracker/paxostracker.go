@@ -1,309 +1,404 @@
 package paxostracker
 
 import (
-	"filelogger/singletonlogger"
+	"filelogger/logger"
 	"fmt"
-	"os"
+	"paxostracker/breakpoint"
 	"paxostracker/errors"
 	"paxostracker/state"
+	"sort"
+	"sync"
+	"time"
 )
 
 /*
-PaxosTracker is a global singleton instantiated per consensuslib client instance to track the state.
+PaxosTracker is instantiated per paxos node to track its state, so several nodes in one process each keep their own.
 Paxostracker uses a DFA representation of the paxos process, and is activated by the consensuslib as it changes state.
 The paxostracker can output the current state at any time.
-The paxostracker can add a wait before the next stage activation.
+The paxostracker can pause or kill the node before a stage, at the breakpoints armed on it (see breakpoints.go).
 Each transition function call will return either nil or error.
+
+A node is active while proposing: Idle -> Preparing -> Proposing -> Learning -> Idle.
+It is passive while its acceptor answers someone else's proposal: Idle -> Promised -> Accepted -> Idle.
+Each neighbour reply and accepted notice counted is a pause point too, without a transition, to watch quorums form.
+Besides its own transitions, the tracker records which nodes it saw promise, accept and learn in each round.
 */
 
 // PaxosTracker struct
 type PaxosTracker struct {
-	currentState state.PaxosState
-}
+	sync.Mutex
+	addr            string
+	currentState    state.PaxosState
+	entered         time.Time // when currentState was entered
+	completedRounds []PaxosRound
+	currentRound    *PaxosRound
+	votes           map[int]*Votes
 
-// global vars
-var tracker *PaxosTracker
-var completedRounds []PaxosRound
-var currentRound *PaxosRound
-
-// signal channels
-var prepareBreak chan struct{}
-var proposeBreak chan struct{}
-var learnBreak chan struct{}
-var idleBreak chan struct{}
-var customBreak chan struct{}
-var prepareKill chan struct{}
-var proposeKill chan struct{}
-var learnKill chan struct{}
-var idleKill chan struct{}
-var customKill chan struct{}
-var continuePaxos chan struct{}
-
-// NewPaxosTracker creates a new tracker
-func NewPaxosTracker() (err error) {
-	tracker = &PaxosTracker{
-		currentState: state.Idle,
-	}
-	prepareBreak = make(chan struct{})
-	proposeBreak = make(chan struct{})
-	learnBreak = make(chan struct{})
-	idleBreak = make(chan struct{})
-	customBreak = make(chan struct{})
-	prepareKill = make(chan struct{})
-	proposeKill = make(chan struct{})
-	learnKill = make(chan struct{})
-	idleKill = make(chan struct{})
-	customKill = make(chan struct{})
-	continuePaxos = make(chan struct{})
-	return nil
+	// breakpoints, guarded by breakLock so they can be managed while a round is paused
+	breakLock      sync.Mutex
+	breakpoints    []breakpoint.Breakpoint
+	nextBreakpoint int
+	paused         []breakpoint.Context
+	continuePaxos  chan struct{}
+
+	logger *logger.Logger
 }
 
-// Prepare request
-func Prepare(callerAddr string) error {
-	if tracker == nil {
-		singletonlogger.Error("Error: PaxosTracker Uninitialised")
-		return nil
+// NewPaxosTracker creates a new tracker for the node at addr, logging to log, or nowhere when log is nil
+func NewPaxosTracker(addr string, log *logger.Logger) *PaxosTracker {
+	if log == nil {
+		log = logger.NewDiscardLogger("paxostracker" + addr)
 	}
+	return &PaxosTracker{
+		addr:           addr,
+		logger:         log,
+		currentState:   state.Idle,
+		votes:          make(map[int]*Votes),
+		nextBreakpoint: 1,
+		continuePaxos:  make(chan struct{}),
+	}
+}
 
-	select {
-	case <-prepareBreak:
-		singletonlogger.Debug("[paxostracker] blocking before prepare")
-		// blocks until continue channel is filled
-		<-continuePaxos
-		singletonlogger.Debug("[paxostracker] continuing...")
-	case <-prepareKill:
-		singletonlogger.Debug("[paxostracker] killing roughly at prepare...")
-		os.Exit(1)
-	default:
+// Prepare request, ctx.Peer is the node proposing
+func (t *PaxosTracker) Prepare(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("prepare")
 	}
-	switch tracker.currentState {
+
+	t.checkpoint(breakpoint.Prepare, ctx)
+
+	t.Lock()
+	defer t.Unlock()
+	switch t.currentState {
 	case state.Idle:
+	case state.Promised, state.Accepted:
+		// a passive round that never got learned here is given up on by proposing
 	default:
 		return errors.BadTransition("")
 	}
-	currentRound = &PaxosRound{
-		InitialAddr: callerAddr,
+	t.currentRound = &PaxosRound{
+		InitialAddr: ctx.Peer,
+		Started:     time.Now(),
 	}
-	tracker.currentState = state.Preparing
+	t.currentState = state.Preparing
+	t.entered = t.currentRound.Started
 	return nil
 }
 
-// Propose request
-func Propose(acceptedPrep uint64) error {
-	if tracker == nil {
-		singletonlogger.Error("Error: PaxosTracker Uninitialised")
-		return nil
+// Propose request for proposal ctx.ID
+func (t *PaxosTracker) Propose(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("propose")
 	}
 
-	select {
-	case <-proposeBreak:
-		singletonlogger.Debug("[paxostracker] blocking before propose")
-		// blocks until continue channel is filled
-		<-continuePaxos
-		singletonlogger.Debug("[paxostracker] continuing...")
-	case <-proposeKill:
-		singletonlogger.Debug("[paxostracker] killing roughly at propose...")
-		os.Exit(1)
-	default:
-	}
+	t.checkpoint(breakpoint.Propose, ctx)
 
-	switch tracker.currentState {
+	t.Lock()
+	defer t.Unlock()
+	switch t.currentState {
 	case state.Preparing:
 	default:
 		return errors.BadTransition("")
 	}
-	currentRound.AcceptedPreparation = acceptedPrep
-	tracker.currentState = state.Proposing
+	t.currentRound.AcceptedPreparation = ctx.ID
+	t.enter(state.Proposing)
 	return nil
 }
 
-// Learn value
-func Learn(acceptedProp uint64) error {
-	if tracker == nil {
-		singletonlogger.Error("Error: PaxosTracker Uninitialised")
-		return nil
+// Learn value of proposal ctx.ID
+func (t *PaxosTracker) Learn(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("learn")
 	}
 
-	select {
-	case <-learnBreak:
-		singletonlogger.Debug("[paxostracker] blocking before learn")
-		// blocks until continue channel is filled
-		<-continuePaxos
-		singletonlogger.Debug("[paxostracker] continuing...")
-	case <-learnKill:
-		singletonlogger.Debug("[paxostracker] killing roughly at learn...")
-		os.Exit(1)
-	default:
-	}
+	t.checkpoint(breakpoint.Learn, ctx)
 
-	switch tracker.currentState {
+	t.Lock()
+	defer t.Unlock()
+	switch t.currentState {
 	case state.Proposing:
 	default:
 		return errors.BadTransition("")
 	}
-	currentRound.AcceptedProposal = acceptedProp
-	tracker.currentState = state.Learning
+	t.currentRound.AcceptedProposal = ctx.ID
+	t.enter(state.Learning)
 	return nil
 }
 
-// Idle return
-func Idle(finalValue string) error {
-	if tracker == nil {
-		singletonlogger.Error("Error: PaxosTracker Uninitialised")
-		return nil
+// Idle return, once ctx.Value is learned
+func (t *PaxosTracker) Idle(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("idle")
 	}
 
-	select {
-	case <-idleBreak:
-		singletonlogger.Debug("[paxostracker] blocking before idle")
-		// blocks until continue channel is filled
-		<-continuePaxos
-		singletonlogger.Debug("[paxostracker] continuing...")
-	case <-idleKill:
-		singletonlogger.Debug("[paxostracker] killing roughly at idle...")
-		os.Exit(1)
-	default:
-	}
+	t.checkpoint(breakpoint.Idle, ctx)
 
+	t.Lock()
+	defer t.Unlock()
 	// check for valid transitions
-	switch tracker.currentState {
+	switch t.currentState {
 	case state.Learning:
 	case state.Accepted:
+	case state.Promised:
 	default:
 		return errors.BadTransition("")
 	}
-	currentRound.Value = finalValue
-	tracker.currentState = state.Idle
+	t.currentRound.Value = ctx.Value
+	t.enter(state.Idle)
 	// save the completed round
-	completedRounds = append(completedRounds, *currentRound)
+	t.completedRounds = append(t.completedRounds, *t.currentRound)
 	// reset current round
-	currentRound = nil
+	t.currentRound = nil
 	return nil
 }
 
-// Custom pause point
-func Custom() error {
-	if tracker == nil {
-		singletonlogger.Error("Error: PaxosTracker Uninitialised")
+// Promise records that this node's acceptor promised proposal ctx.ID from proposer ctx.Peer in round ctx.Round
+func (t *PaxosTracker) Promise(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("promise")
+	}
+	t.checkpoint(breakpoint.Promise, ctx)
+
+	round := ctx.Round
+	t.Lock()
+	defer t.Unlock()
+	t.vote(round).Promised = addVote(t.vote(round).Promised, t.addr)
+	if t.learnedHere(round) {
 		return nil
 	}
-	select {
-	case <-customBreak:
-		singletonlogger.Debug("[paxostracker] blocking before custom")
-		<-continuePaxos
-		singletonlogger.Debug("[paxostracker] continuing...")
-	case <-customKill:
-		singletonlogger.Debug("[paxostracker] killing roughly at custom...")
-		os.Exit(1)
+	switch t.currentState {
+	case state.Idle:
+		t.begin(state.Promised)
+	case state.Promised:
+	case state.Preparing, state.Proposing, state.Learning:
+		// an active node promises its own proposals, which is not a passive transition
+		t.currentRound.Round = round
+		return nil
 	default:
+		return errors.BadTransition("")
 	}
+	t.currentRound.Round = round
+	t.currentRound.InitialAddr = ctx.Peer
+	t.currentRound.AcceptedPreparation = ctx.ID
 	return nil
 }
 
-// Error transition
-func Error(reason string) error {
-	if tracker == nil {
-		singletonlogger.Error("Error: PaxosTracker Uninitialised")
+// Accept records that this node's acceptor accepted proposal ctx.ID from proposer ctx.Peer in round ctx.Round
+func (t *PaxosTracker) Accept(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("accept")
+	}
+	t.checkpoint(breakpoint.Accept, ctx)
+
+	round := ctx.Round
+	t.Lock()
+	defer t.Unlock()
+	t.vote(round).Accepted = addVote(t.vote(round).Accepted, t.addr)
+	if t.learnedHere(round) {
+		// the learner already heard of a majority accepting, there is no round left to move through
 		return nil
 	}
-	// valid for all transitions
-	currentRound.ErrorReason = reason
-	tracker.currentState = state.Idle
-	// save the completed round
-	completedRounds = append(completedRounds, *currentRound)
-	// reset current round
-	currentRound = nil
+	switch t.currentState {
+	case state.Idle:
+		// the prepare request was missed, but a later accept request may still be accepted
+		t.begin(state.Accepted)
+		t.currentRound.AcceptedPreparation = ctx.ID
+	case state.Promised:
+		t.enter(state.Accepted)
+	case state.Accepted:
+	case state.Preparing, state.Proposing, state.Learning:
+		t.currentRound.Round = round
+		return nil
+	default:
+		return errors.BadTransition("")
+	}
+	t.currentRound.Round = round
+	t.currentRound.InitialAddr = ctx.Peer
+	t.currentRound.AcceptedProposal = ctx.ID
 	return nil
 }
 
-// BreakNextPrepare will block on the next prepare call till continue
-func BreakNextPrepare() error {
-	singletonlogger.Debug("[paxostracker] Filling preparebreak channel for next round")
-	prepareBreak <- struct{}{}
-	return nil
+// Learned records that this node learned the value of round
+func (t *PaxosTracker) Learned(round int) {
+	t.LearnedBy(round, t.addr)
 }
 
-// BreakNextPropose will block on the next propose call till continue
-func BreakNextPropose() error {
-	singletonlogger.Debug("[paxostracker] Filling proposebreak channel for next round")
-	proposeBreak <- struct{}{}
-	return nil
+// PromisedBy records that the node at addr promised in round
+func (t *PaxosTracker) PromisedBy(round int, addr string) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.vote(round).Promised = addVote(t.vote(round).Promised, addr)
 }
 
-// BreakNextLearn will block on the next learn call till continue
-func BreakNextLearn() error {
-	singletonlogger.Debug("[paxostracker] Filling learnbreak channel for next round")
-	learnBreak <- struct{}{}
-	return nil
+// AcceptedBy records that the node at addr accepted in round
+func (t *PaxosTracker) AcceptedBy(round int, addr string) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.vote(round).Accepted = addVote(t.vote(round).Accepted, addr)
 }
 
-// BreakNextIdle will block on the next idle call till continue
-func BreakNextIdle() error {
-	singletonlogger.Debug("[paxostracker] Filling idleBreak channel for next round")
-	idleBreak <- struct{}{}
-	return nil
+// LearnedBy records that the node at addr learned the value of round
+func (t *PaxosTracker) LearnedBy(round int, addr string) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.vote(round).Learned = addVote(t.vote(round).Learned, addr)
 }
 
-// BreakNextCustom will block on the next custom call till continue
-func BreakNextCustom() error {
-	singletonlogger.Debug("[paxostracker] Filling customBreak channel for next round")
-	customBreak <- struct{}{}
-	return nil
+// begin a new passive round in first, the tracker must be locked
+func (t *PaxosTracker) begin(first state.PaxosState) {
+	t.currentRound = &PaxosRound{Started: time.Now()}
+	t.currentState = first
+	t.entered = t.currentRound.Started
 }
 
-// Continue the execution of paxos
-func Continue() error {
-	singletonlogger.Debug("[paxostracker] Filling continue channel for next round")
-	continuePaxos <- struct{}{}
-	return nil
+// enter moves to next, adding the time spent in the state being left to the current round.
+// The tracker must be locked.
+func (t *PaxosTracker) enter(next state.PaxosState) {
+	now := time.Now()
+	if t.currentRound != nil && t.currentState != state.Idle {
+		if t.currentRound.Durations == nil {
+			t.currentRound.Durations = make(map[state.PaxosState]time.Duration)
+		}
+		t.currentRound.Durations[t.currentState] += now.Sub(t.entered)
+	}
+	t.currentState = next
+	t.entered = now
 }
 
-// KillNextPrepare will block on the next prepare call till continue
-func KillNextPrepare() error {
-	singletonlogger.Debug("[paxostracker] Filling preparebreak channel for next round")
-	prepareKill <- struct{}{}
-	return nil
+// learnedHere is true once this node learned the value of round, the tracker must be locked
+func (t *PaxosTracker) learnedHere(round int) bool {
+	for _, addr := range t.vote(round).Learned {
+		if addr == t.addr {
+			return true
+		}
+	}
+	return false
 }
 
-// KillNextPropose will block on the next propose call till continue
-func KillNextPropose() error {
-	singletonlogger.Debug("[paxostracker] Filling proposebreak channel for next round")
-	proposeKill <- struct{}{}
+// vote returns the votes of round, the tracker must be locked
+func (t *PaxosTracker) vote(round int) *Votes {
+	votes, ok := t.votes[round]
+	if !ok {
+		votes = &Votes{}
+		t.votes[round] = votes
+	}
+	return votes
+}
+
+// Reply counted from neighbour ctx.Peer to the prepare or accept request ctx.ID, ctx.Votes of ctx.Of in favour so far
+func (t *PaxosTracker) Reply(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("reply")
+	}
+	t.checkpoint(breakpoint.Reply, ctx)
 	return nil
 }
 
-// KillNextLearn will block on the next learn call till continue
-func KillNextLearn() error {
-	singletonlogger.Debug("[paxostracker] Filling learnbreak channel for next round")
-	learnKill <- struct{}{}
+// Notify counted that acceptor ctx.Peer accepted proposal ctx.ID, ctx.Votes of ctx.Of accepted so far
+func (t *PaxosTracker) Notify(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("notify")
+	}
+	t.checkpoint(breakpoint.Notify, ctx)
 	return nil
 }
 
-// KillNextIdle will block on the next idle call till continue
-func KillNextIdle() error {
-	singletonlogger.Debug("[paxostracker] Filling idleKill channel for next round")
-	idleKill <- struct{}{}
+// Custom pause point
+func (t *PaxosTracker) Custom(ctx breakpoint.Context) error {
+	if t == nil {
+		return errors.Uninitialised("custom")
+	}
+	t.checkpoint(breakpoint.Custom, ctx)
 	return nil
 }
 
-// KillNextCustom will block on the next custom call till continue
-func KillNextCustom() error {
-	singletonlogger.Debug("[paxostracker] Filling customKill channel for next round")
-	customKill <- struct{}{}
+// Error transition
+func (t *PaxosTracker) Error(reason string) error {
+	if t == nil {
+		return errors.Uninitialised("error")
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.currentRound == nil {
+		t.currentRound = &PaxosRound{}
+	}
+	// valid for all transitions
+	t.currentRound.ErrorReason = reason
+	t.enter(state.Idle)
+	// save the completed round
+	t.completedRounds = append(t.completedRounds, *t.currentRound)
+	// reset current round
+	t.currentRound = nil
 	return nil
 }
 
+// State returns the state this node's paxos process is currently in
+func (t *PaxosTracker) State() state.PaxosState {
+	if t == nil {
+		return state.Idle
+	}
+	t.Lock()
+	defer t.Unlock()
+	return t.currentState
+}
+
+// Rounds returns a copy of the rounds this node has completed, ordered by round, with the votes seen in each.
+// Rounds this node only saw votes for are included too.
+func (t *PaxosTracker) Rounds() []PaxosRound {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	rounds := make([]PaxosRound, 0, len(t.completedRounds))
+	seen := make(map[int]bool)
+	for _, round := range t.completedRounds {
+		if votes, ok := t.votes[round.Round]; ok {
+			round.Votes = copyVotes(votes)
+		}
+		if round.Durations != nil {
+			durations := make(map[state.PaxosState]time.Duration, len(round.Durations))
+			for phase, d := range round.Durations {
+				durations[phase] = d
+			}
+			round.Durations = durations
+		}
+		seen[round.Round] = true
+		rounds = append(rounds, round)
+	}
+	for num, votes := range t.votes {
+		if !seen[num] {
+			rounds = append(rounds, PaxosRound{Round: num, Votes: copyVotes(votes)})
+		}
+	}
+	sort.SliceStable(rounds, func(i, j int) bool {
+		return rounds[i].Round < rounds[j].Round
+	})
+	return rounds
+}
+
+func copyVotes(votes *Votes) Votes {
+	return Votes{
+		Promised: append([]string(nil), votes.Promised...),
+		Accepted: append([]string(nil), votes.Accepted...),
+		Learned:  append([]string(nil), votes.Learned...),
+	}
+}
+
 // AsTable returns the current state of the paxos process in human consumable table form.
-func AsTable() string {
-	rows := "| Initial Addr | AcceptedPrepare | AcceptedProposal | Value |\n"
-	for _, round := range completedRounds {
+func (t *PaxosTracker) AsTable() string {
+	rows := "| Round | Initial Addr | AcceptedPrepare | AcceptedProposal | Value | Promised | Accepted | Learned |\n"
+	for _, round := range t.Rounds() {
 		rows += round.AsRow()
 	}
-	var pstate state.PaxosState
-	if tracker == nil {
-		pstate = state.Idle
-	} else {
-		pstate = tracker.currentState
-	}
-	return fmt.Sprintf("\n======================\nCurrent State: %v\n======================\n%v", pstate, rows)
+	return fmt.Sprintf("\n======================\nCurrent State: %v\n======================\n%v", t.State(), rows)
 }
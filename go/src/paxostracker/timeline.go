@@ -0,0 +1,107 @@
+package paxostracker
+
+import (
+	"fmt"
+	"paxostracker/state"
+	"sort"
+	"time"
+)
+
+/*
+A timeline merges the rounds recorded by every node's tracker into one view of each slot of the log.
+Clocks differ between nodes, so phase durations are only ever taken from the proposer's own record.
+*/
+
+// Slot is one round of paxos as seen by the whole cluster
+type Slot struct {
+	Round     int
+	Proposers []string // nodes that proposed in the round, or that others promised to
+	Values    []string // values learned for the round, more than one breaks safety
+	Reporters []string // nodes whose records went into the slot
+	Durations map[state.PaxosState]time.Duration
+	Conflicts []string
+	Votes
+}
+
+// Timeline merges the rounds reported by each node, keyed by node address, into one slot per round
+func Timeline(reports map[string][]PaxosRound) []Slot {
+	slots := make(map[int]*Slot)
+	for reporter, rounds := range reports {
+		for _, round := range rounds {
+			slot, ok := slots[round.Round]
+			if !ok {
+				slot = &Slot{Round: round.Round}
+				slots[round.Round] = slot
+			}
+			slot.Reporters = addVote(slot.Reporters, reporter)
+			if round.InitialAddr != "" {
+				slot.Proposers = addVote(slot.Proposers, round.InitialAddr)
+			}
+			if round.Value != "" {
+				slot.Values = addVote(slot.Values, round.Value)
+			}
+			for _, addr := range round.Promised {
+				slot.Promised = addVote(slot.Promised, addr)
+			}
+			for _, addr := range round.Accepted {
+				slot.Accepted = addVote(slot.Accepted, addr)
+			}
+			for _, addr := range round.Learned {
+				slot.Learned = addVote(slot.Learned, addr)
+			}
+			if round.ErrorReason != "" {
+				slot.Conflicts = append(slot.Conflicts, fmt.Sprintf("%s: %s", reporter, round.ErrorReason))
+			}
+			if reporter == round.InitialAddr && round.Durations != nil {
+				slot.Durations = round.Durations
+			}
+		}
+	}
+
+	timeline := make([]Slot, 0, len(slots))
+	for _, slot := range slots {
+		if len(slot.Proposers) > 1 {
+			slot.Conflicts = append(slot.Conflicts, fmt.Sprintf("%d competing proposers", len(slot.Proposers)))
+		}
+		if len(slot.Values) > 1 {
+			slot.Conflicts = append(slot.Conflicts, fmt.Sprintf("%d different values learned", len(slot.Values)))
+		}
+		timeline = append(timeline, *slot)
+	}
+	sort.Slice(timeline, func(i, j int) bool {
+		return timeline[i].Round < timeline[j].Round
+	})
+	return timeline
+}
+
+// AsRow converts a slot to a string row
+func (s *Slot) AsRow() string {
+	conflicts := "-"
+	if len(s.Conflicts) > 0 {
+		conflicts = fmt.Sprintf("%q", s.Conflicts)
+	}
+	return fmt.Sprintf("| %d | %s | %s | %d | %d | %d | %s | %s | %s | %s |\n", s.Round, asCell(s.Proposers), asCell(s.Values),
+		len(s.Promised), len(s.Accepted), len(s.Learned),
+		s.phase(state.Preparing), s.phase(state.Proposing), s.phase(state.Learning), conflicts)
+}
+
+func (s *Slot) phase(phase state.PaxosState) string {
+	d, ok := s.Durations[phase]
+	if !ok {
+		return "-"
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+// TimelineAsTable returns the cluster-wide timeline in human consumable table form.
+// unreachable lists the nodes whose rounds could not be collected.
+func TimelineAsTable(timeline []Slot, unreachable []string) string {
+	rows := "| Round | Proposers | Values | Promises | Accepts | Learned | Prepare | Accept | Learn | Conflicts |\n"
+	for _, slot := range timeline {
+		rows += slot.AsRow()
+	}
+	if len(unreachable) > 0 {
+		rows += fmt.Sprintf("Unreachable: %s\n", asCell(unreachable))
+	}
+	return fmt.Sprintf("\n======================\nCluster Timeline\n======================\n%v", rows)
+}